@@ -0,0 +1,122 @@
+package alphakey
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+)
+
+// Generator provides an interface by which to fetch the alpha keys of a JSON array of company names, returned
+// as a JSON array of keys in the same order. The remote alpha key service, reached through eshttp.Client,
+// satisfies it as well as the local implementation.
+type Generator interface {
+	GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error)
+}
+
+// Local provides a concrete implementation of the Generator interface which works out alpha keys itself,
+// without calling the alpha key service
+type Local struct{}
+
+// NewLocalGenerator returns a concrete implementation of the Generator interface needing no alpha key service
+func NewLocalGenerator() Generator {
+
+	return &Local{}
+}
+
+// GetAlphaKeys returns the alpha keys of the given company names, ignoring alphaKeyURL
+func (l *Local) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+
+	var names []datastructures.CompanyName
+	if err := json.Unmarshal(companyNames, &names); err != nil {
+		return nil, fmt.Errorf("error unmarshalling company names: %s", err)
+	}
+
+	keys := make([]datastructures.AlphaKey, len(names))
+	for i, name := range names {
+		keys[i] = Key(name.Name)
+	}
+	return json.Marshal(keys)
+}
+
+// symbols are the characters spelt out in words in alpha keys, so that a name using one matches a name
+// spelling it out
+var symbols = strings.NewReplacer(
+	"&", " AND ",
+	"+", " PLUS ",
+	"@", " AT ",
+	"%", " PERCENT ",
+	"£", " POUND ",
+	"$", " DOLLAR ",
+	"€", " EURO ",
+)
+
+// endings are the words, longest first, which denote the type of a company rather than telling companies
+// apart, and so are dropped from the end of a name in its same-as key
+var endings = [][]string{
+	{"PUBLIC", "LIMITED", "COMPANY"},
+	{"CWMNI", "CYFYNGEDIG", "CYHOEDDUS"},
+	{"LIMITED", "LIABILITY", "PARTNERSHIP"},
+	{"PARTNERIAETH", "ATEBOLRWYDD", "CYFYNGEDIG"},
+	{"COMMUNITY", "INTEREST", "COMPANY"},
+	{"COMMUNITY", "INTEREST", "PLC"},
+	{"LIMITED"}, {"LTD"}, {"PLC"}, {"LLP"}, {"CIC"}, {"UNLIMITED"},
+	{"CYFYNGEDIG"}, {"CYF"}, {"CCC"}, {"CBC"}, {"PAC"},
+}
+
+// Key returns the alpha keys of a company name. The ordered key is the name in capitals without a leading
+// 'THE' and with only its letters, of whatever alphabet, and digits remaining. The same-as key is the ordered key of the name without
+// the words at its end which denote its company type.
+func Key(name string) datastructures.AlphaKey {
+	var words []string
+	for _, word := range strings.Fields(symbols.Replace(strings.ToUpper(name))) {
+		if word = alphanumeric(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) > 1 && words[0] == "THE" {
+		words = words[1:]
+	}
+
+	return datastructures.AlphaKey{
+		SameAsAlphaKey:  strings.Join(withoutEnding(words), ""),
+		OrderedAlphaKey: strings.Join(words, ""),
+	}
+}
+
+// withoutEnding returns words without the company type ending them, if any, unless nothing else would remain
+func withoutEnding(words []string) []string {
+	for _, ending := range endings {
+		n := len(words) - len(ending)
+		if n >= 1 && equal(words[n:], ending) {
+			return words[:n]
+		}
+	}
+	return words
+}
+
+// equal reports whether two lists of words are the same
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// alphanumeric returns just the letters and digits of word, as format.StripCompanyName keeps them
+func alphanumeric(word string) string {
+	var b strings.Builder
+	for _, r := range word {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package alphakey
+
+import (
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitKey(t *testing.T) {
+
+	Convey("Should capitalise the name and keep only its letters and digits", t, func() {
+
+		So(Key("Acme Widgets (UK) Ltd."), ShouldResemble, datastructures.AlphaKey{
+			SameAsAlphaKey:  "ACMEWIDGETSUK",
+			OrderedAlphaKey: "ACMEWIDGETSUKLTD",
+		})
+	})
+
+	Convey("Should keep letters outside the English alphabet", t, func() {
+
+		So(Key("Café Société Ltd"), ShouldResemble, datastructures.AlphaKey{
+			SameAsAlphaKey:  "CAFÉSOCIÉTÉ",
+			OrderedAlphaKey: "CAFÉSOCIÉTÉLTD",
+		})
+	})
+
+	Convey("Should drop a leading 'The' from both keys", t, func() {
+
+		So(Key("THE 1ST WIDGET COMPANY LIMITED"), ShouldResemble, datastructures.AlphaKey{
+			SameAsAlphaKey:  "1STWIDGETCOMPANY",
+			OrderedAlphaKey: "1STWIDGETCOMPANYLIMITED",
+		})
+	})
+
+	Convey("Should give names differing only in their company type the same same-as key", t, func() {
+
+		So(Key("Acme & Sons PLC").SameAsAlphaKey, ShouldEqual, "ACMEANDSONS")
+		So(Key("ACME AND SONS PUBLIC LIMITED COMPANY").SameAsAlphaKey, ShouldEqual, "ACMEANDSONS")
+		So(Key("Acme and Sons Cyfyngedig").SameAsAlphaKey, ShouldEqual, "ACMEANDSONS")
+	})
+
+	Convey("Should spell out symbols", t, func() {
+
+		So(Key("100% Widgets+ @ Home LIMITED").SameAsAlphaKey, ShouldEqual, "100PERCENTWIDGETSPLUSATHOME")
+	})
+
+	Convey("Should not drop the whole of a name", t, func() {
+
+		So(Key("The Limited"), ShouldResemble, datastructures.AlphaKey{SameAsAlphaKey: "LIMITED", OrderedAlphaKey: "LIMITED"})
+		So(Key("The"), ShouldResemble, datastructures.AlphaKey{SameAsAlphaKey: "THE", OrderedAlphaKey: "THE"})
+	})
+}
+
+func TestUnitLocalGetAlphaKeys(t *testing.T) {
+
+	Convey("Should return the keys of each name in order", t, func() {
+
+		keys, err := NewLocalGenerator().GetAlphaKeys([]byte(`[{"name":"Acme Ltd"},{"name":"The Widget Co"}]`), "")
+
+		So(err, ShouldBeNil)
+		So(string(keys), ShouldEqual, `[{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"},{"sameAsAlphaKey":"WIDGETCO","orderedAlphaKey":"WIDGETCO"}]`)
+	})
+
+	Convey("Should fail when the names are not valid JSON", t, func() {
+
+		_, err := NewLocalGenerator().GetAlphaKeys([]byte(`[{"name":`), "")
+
+		So(err, ShouldNotBeNil)
+	})
+}
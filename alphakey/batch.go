@@ -0,0 +1,185 @@
+package alphakey
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+)
+
+// Batcher provides an implementation of the Generator interface which regroups the names it is asked about
+// into batches of its own size before passing them on, splitting long lists of names and combining short ones
+// asked about at around the same time. It passes on a limited number of batches at once.
+type Batcher struct {
+	next     Generator
+	size     int
+	linger   time.Duration
+	slots    chan struct{}
+	requests chan *batchRequest
+}
+
+// batchRequest is a list of names asked about through the Batcher, waiting for all of their keys
+type batchRequest struct {
+	mu      sync.Mutex
+	names   []datastructures.CompanyName
+	url     string
+	keys    []datastructures.AlphaKey
+	pending int
+	err     error
+	done    chan struct{}
+}
+
+// batchEntry is a name in a batch, identified by the request it came from and its position there
+type batchEntry struct {
+	request *batchRequest
+	index   int
+}
+
+// NewBatcher returns a Generator passing names on to next in batches of size, with at most concurrency batches
+// in progress at once. Having received fewer names than size, it waits up to linger for more before passing them
+// on. Names asked about at the same time are expected to share the same alphaKeyURL.
+func NewBatcher(next Generator, size int, concurrency int, linger time.Duration) Generator {
+
+	if size < 1 {
+		size = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	b := &Batcher{
+		next:     next,
+		size:     size,
+		linger:   linger,
+		slots:    make(chan struct{}, concurrency),
+		requests: make(chan *batchRequest),
+	}
+	go b.dispatch()
+	return b
+}
+
+// GetAlphaKeys returns the keys of the given company names once every batch holding them has been passed on
+func (b *Batcher) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+
+	var names []datastructures.CompanyName
+	if err := json.Unmarshal(companyNames, &names); err != nil {
+		return nil, fmt.Errorf("error unmarshalling company names: %s", err)
+	}
+
+	r := &batchRequest{
+		names:   names,
+		url:     alphaKeyURL,
+		keys:    make([]datastructures.AlphaKey, len(names)),
+		pending: len(names),
+		done:    make(chan struct{}),
+	}
+	if len(names) > 0 {
+		b.requests <- r
+		<-r.done
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return json.Marshal(r.keys)
+}
+
+// dispatch gathers the names of requests into batches, passing each on once it is full or has waited for
+// linger, until the process ends
+func (b *Batcher) dispatch() {
+	var batch []batchEntry
+	var deadline <-chan time.Time
+
+	for {
+		if len(batch) == 0 {
+			batch = b.add(batch, <-b.requests)
+			deadline = time.After(b.linger)
+			continue
+		}
+
+		select {
+		case r := <-b.requests:
+			batch = b.add(batch, r)
+		case <-deadline:
+			b.send(batch)
+			batch = nil
+		}
+	}
+}
+
+// add appends the names of r to batch, passing on full batches, and returns what remains
+func (b *Batcher) add(batch []batchEntry, r *batchRequest) []batchEntry {
+	for i := range r.names {
+		batch = append(batch, batchEntry{request: r, index: i})
+		if len(batch) == b.size {
+			b.send(batch)
+			batch = nil
+		}
+	}
+	return batch
+}
+
+// send passes a batch on to the next Generator once one of the slots for a batch in progress is free,
+// delivering the keys to the requests the names came from
+func (b *Batcher) send(batch []batchEntry) {
+	b.slots <- struct{}{}
+
+	go func() {
+		defer func() { <-b.slots }()
+
+		names := make([]datastructures.CompanyName, len(batch))
+		for i, entry := range batch {
+			names[i] = entry.request.names[entry.index]
+		}
+
+		keys, err := b.fetch(names, batch[0].request.url)
+		for i, entry := range batch {
+			var key datastructures.AlphaKey
+			if keys != nil {
+				key = keys[i]
+			}
+			entry.request.deliver(entry.index, key, err)
+		}
+	}()
+}
+
+// fetch returns the keys of names from the next Generator. Keys which cannot be matched to names, because
+// there are too many or too few of them, are dropped, leaving the names with the empty keys marking a failure.
+func (b *Batcher) fetch(names []datastructures.CompanyName, url string) ([]datastructures.AlphaKey, error) {
+	body, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.next.GetAlphaKeys(body, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []datastructures.AlphaKey
+	if err := json.Unmarshal(res, &keys); err != nil {
+		return nil, fmt.Errorf("error unmarshalling alpha keys [%s]: %s", res, err)
+	}
+	if len(keys) != len(names) {
+		log.Printf("%d alpha keys returned for %d names, discarding them", len(keys), len(names))
+		return nil, nil
+	}
+	return keys, nil
+}
+
+// deliver records the key, or error, for the name at index, completing the request once all are recorded
+func (r *batchRequest) deliver(index int, key datastructures.AlphaKey, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.err = err
+	}
+	r.keys[index] = key
+	r.pending--
+	if r.pending == 0 {
+		close(r.done)
+	}
+}
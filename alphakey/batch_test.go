@@ -0,0 +1,150 @@
+package alphakey
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingGenerator works out keys locally, recording the batches of names it was asked about and how many
+// it was asked about at once
+type recordingGenerator struct {
+	mu      sync.Mutex
+	asked   []string
+	active  int
+	busiest int
+	hold    time.Duration
+	err     error
+}
+
+func (g *recordingGenerator) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+	g.mu.Lock()
+	g.asked = append(g.asked, string(companyNames))
+	g.active++
+	if g.active > g.busiest {
+		g.busiest = g.active
+	}
+	g.mu.Unlock()
+
+	time.Sleep(g.hold)
+
+	g.mu.Lock()
+	g.active--
+	g.mu.Unlock()
+
+	if g.err != nil {
+		return nil, g.err
+	}
+	return NewLocalGenerator().GetAlphaKeys(companyNames, alphaKeyURL)
+}
+
+func TestUnitBatcher(t *testing.T) {
+
+	Convey("Given a batcher of two names at a time", t, func() {
+
+		next := &recordingGenerator{}
+		b := NewBatcher(next, 2, 1, 0)
+
+		Convey("When asked about five names", func() {
+
+			keys, err := b.GetAlphaKeys([]byte(`[{"name":"A Ltd"},{"name":"B Ltd"},{"name":"C Ltd"},{"name":"D Ltd"},{"name":"E Ltd"}]`), "url")
+			So(err, ShouldBeNil)
+
+			Convey("Then the names should be passed on two at a time", func() {
+
+				So(next.asked, ShouldResemble, []string{
+					`[{"name":"A Ltd"},{"name":"B Ltd"}]`,
+					`[{"name":"C Ltd"},{"name":"D Ltd"}]`,
+					`[{"name":"E Ltd"}]`,
+				})
+			})
+
+			Convey("Then every key should be returned in order", func() {
+
+				So(string(keys), ShouldEqual, `[{"sameAsAlphaKey":"A","orderedAlphaKey":"ALTD"},`+
+					`{"sameAsAlphaKey":"B","orderedAlphaKey":"BLTD"},`+
+					`{"sameAsAlphaKey":"C","orderedAlphaKey":"CLTD"},`+
+					`{"sameAsAlphaKey":"D","orderedAlphaKey":"DLTD"},`+
+					`{"sameAsAlphaKey":"E","orderedAlphaKey":"ELTD"}]`)
+			})
+		})
+	})
+
+	Convey("Given a batcher of ten names at a time, waiting for more names", t, func() {
+
+		next := &recordingGenerator{}
+		b := NewBatcher(next, 10, 1, 200*time.Millisecond)
+
+		Convey("When asked about five single names at once", func() {
+
+			var wg sync.WaitGroup
+			keys := make([]string, 5)
+			for i, name := range []string{"A", "B", "C", "D", "E"} {
+				wg.Add(1)
+				go func(i int, name string) {
+					defer wg.Done()
+					k, _ := b.GetAlphaKeys([]byte(`[{"name":"`+name+` Ltd"}]`), "url")
+					keys[i] = string(k)
+				}(i, name)
+			}
+			wg.Wait()
+
+			Convey("Then the names should be passed on together", func() {
+
+				So(next.asked, ShouldHaveLength, 1)
+			})
+
+			Convey("Then each should receive its own key", func() {
+
+				So(keys[0], ShouldEqual, `[{"sameAsAlphaKey":"A","orderedAlphaKey":"ALTD"}]`)
+				So(keys[4], ShouldEqual, `[{"sameAsAlphaKey":"E","orderedAlphaKey":"ELTD"}]`)
+			})
+		})
+	})
+
+	Convey("Should pass on no more batches at once than allowed", t, func() {
+
+		next := &recordingGenerator{hold: 10 * time.Millisecond}
+		b := NewBatcher(next, 1, 2, 0)
+
+		_, err := b.GetAlphaKeys([]byte(`[{"name":"A"},{"name":"B"},{"name":"C"},{"name":"D"},{"name":"E"},{"name":"F"}]`), "url")
+
+		So(err, ShouldBeNil)
+		So(next.asked, ShouldHaveLength, 6)
+		So(next.busiest, ShouldEqual, 2)
+	})
+
+	Convey("Should return an error when a batch fails", t, func() {
+
+		next := &recordingGenerator{err: errors.New("unavailable")}
+		b := NewBatcher(next, 2, 1, 0)
+
+		keys, err := b.GetAlphaKeys([]byte(`[{"name":"A"},{"name":"B"},{"name":"C"}]`), "url")
+
+		So(keys, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Should leave the keys of names empty when they cannot be matched to the keys returned", t, func() {
+
+		b := NewBatcher(fixedGenerator{keys: `[]`}, 2, 1, 0)
+
+		keys, err := b.GetAlphaKeys([]byte(`[{"name":"A"},{"name":"B"}]`), "url")
+
+		So(err, ShouldBeNil)
+		So(string(keys), ShouldEqual, `[{"sameAsAlphaKey":"","orderedAlphaKey":""},{"sameAsAlphaKey":"","orderedAlphaKey":""}]`)
+	})
+
+	Convey("Should return no keys for no names", t, func() {
+
+		b := NewBatcher(&recordingGenerator{}, 2, 1, 0)
+
+		keys, err := b.GetAlphaKeys([]byte(`[]`), "url")
+
+		So(err, ShouldBeNil)
+		So(string(keys), ShouldEqual, `[]`)
+	})
+}
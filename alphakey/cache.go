@@ -0,0 +1,241 @@
+package alphakey
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+)
+
+// Cache provides an interface to a Generator which remembers the keys of the names it has been asked about
+type Cache interface {
+	Generator
+	Stats() (hits int64, misses int64)
+	Close() error
+}
+
+// Cached provides a concrete implementation of the Cache interface, holding keys in memory and, optionally,
+// appending them to a file from which they are read back by the next run
+type Cached struct {
+	mu     sync.Mutex
+	next   Generator
+	size   int
+	keys   map[string]datastructures.AlphaKey
+	file   *os.File
+	stored map[string]bool
+	hits   int64
+	misses int64
+}
+
+// cacheHeader is the first line of the cache file, naming the source of the keys it holds
+type cacheHeader struct {
+	Source string `json:"source"`
+}
+
+// cacheEntry is a line of the cache file after the header
+type cacheEntry struct {
+	Name string                  `json:"name"`
+	Key  datastructures.AlphaKey `json:"key"`
+}
+
+// NewCache returns a concrete implementation of the Cache interface asking next for the keys of names it has
+// not seen, and holding at most size keys in memory, or any number if size is 0. Keys are also kept in the file
+// at path, unless path is empty, which must hold keys from the named source.
+func NewCache(next Generator, path string, size int, source string) (Cache, error) {
+
+	c := &Cached{
+		next: next,
+		size: size,
+		keys: make(map[string]datastructures.AlphaKey),
+	}
+	if path == "" {
+		return c, nil
+	}
+
+	c.stored = make(map[string]bool)
+	headed, err := c.read(path, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return nil, fmt.Errorf("error opening alpha key cache [%s]: %s", path, err)
+	}
+	if !headed {
+		line, _ := json.Marshal(cacheHeader{Source: source})
+		if _, err := c.file.Write(append(line, '\n')); err != nil {
+			c.file.Close()
+			return nil, fmt.Errorf("error writing alpha key cache [%s]: %s", path, err)
+		}
+	}
+	return c, nil
+}
+
+// GetAlphaKeys returns the keys of the given company names, asking the next Generator for just those not
+// already cached
+func (c *Cached) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+
+	var names []datastructures.CompanyName
+	if err := json.Unmarshal(companyNames, &names); err != nil {
+		return nil, fmt.Errorf("error unmarshalling company names: %s", err)
+	}
+
+	keys := make([]datastructures.AlphaKey, len(names))
+	var missing []int
+	var misses []datastructures.CompanyName
+
+	c.mu.Lock()
+	for i, name := range names {
+		if key, ok := c.keys[normalise(name.Name)]; ok {
+			keys[i] = key
+		} else {
+			missing = append(missing, i)
+			misses = append(misses, name)
+		}
+	}
+	c.mu.Unlock()
+
+	atomic.AddInt64(&c.hits, int64(len(names)-len(misses)))
+	atomic.AddInt64(&c.misses, int64(len(misses)))
+
+	if len(misses) > 0 {
+		body, err := json.Marshal(misses)
+		if err != nil {
+			return nil, err
+		}
+		b, err := c.next.GetAlphaKeys(body, alphaKeyURL)
+		if err != nil {
+			return nil, err
+		}
+		var fetched []datastructures.AlphaKey
+		if err := json.Unmarshal(b, &fetched); err != nil {
+			return nil, fmt.Errorf("error unmarshalling alpha keys [%s]: %s", b, err)
+		}
+		// Keys cannot be matched to names when there are too many or too few of them, so the names
+		// are left with the empty keys that mark a failure, for the caller to deal with.
+		if len(fetched) == len(misses) {
+			for i, key := range fetched {
+				keys[missing[i]] = key
+			}
+			if err := c.add(misses, fetched); err != nil {
+				return nil, err
+			}
+		} else {
+			log.Printf("%d alpha keys returned for %d names, none of which are cached", len(fetched), len(misses))
+		}
+	}
+
+	return json.Marshal(keys)
+}
+
+// Stats returns the number of names whose keys were found in the cache, and the number which were not
+func (c *Cached) Stats() (int64, int64) {
+
+	return atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses)
+}
+
+// Close closes the cache file, if any
+func (c *Cached) Close() error {
+
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+// add caches the keys of names, appending those of names not already stored to the cache file if there is one
+func (c *Cached) add(names []datastructures.CompanyName, keys []datastructures.AlphaKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var lines []byte
+	for i, name := range names {
+		// An empty key is a failure to be retried, not an answer to remember.
+		if keys[i].SameAsAlphaKey == "" || keys[i].OrderedAlphaKey == "" {
+			continue
+		}
+		normalised := normalise(name.Name)
+		c.put(normalised, keys[i])
+		// A name evicted from memory, or fetched by two batches at once, is already in the file.
+		if c.file != nil && !c.stored[normalised] {
+			c.stored[normalised] = true
+			line, err := json.Marshal(cacheEntry{Name: name.Name, Key: keys[i]})
+			if err != nil {
+				return err
+			}
+			lines = append(append(lines, line...), '\n')
+		}
+	}
+
+	if len(lines) > 0 {
+		if _, err := c.file.Write(lines); err != nil {
+			return fmt.Errorf("error writing alpha key cache [%s]: %s", c.file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// put holds key in memory, first evicting an arbitrary key if the cache is full. It must be called with mu held.
+func (c *Cached) put(name string, key datastructures.AlphaKey) {
+	if _, ok := c.keys[name]; !ok && c.size > 0 && len(c.keys) >= c.size {
+		for evict := range c.keys {
+			delete(c.keys, evict)
+			break
+		}
+	}
+	c.keys[name] = key
+}
+
+// read loads the keys in the cache file at path, if it exists, returning whether it has a header. A file
+// holding keys from a source other than the one named is refused, as its keys may differ.
+func (c *Cached) read(path string, source string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error opening alpha key cache [%s]: %s", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return false, scanner.Err()
+	}
+	var header cacheHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Source == "" {
+		return false, fmt.Errorf("alpha key cache [%s] does not record the source of its keys, delete it to start afresh", path)
+	}
+	if header.Source != source {
+		return false, fmt.Errorf("alpha key cache [%s] holds keys from the [%s] source, not [%s]", path, header.Source, source)
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		// A line cut short by a run dying mid-write costs no more than a cache miss.
+		var entry cacheEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("skipping line %d of alpha key cache [%s]: %s", line, path, err)
+			continue
+		}
+		normalised := normalise(entry.Name)
+		c.put(normalised, entry.Key)
+		c.stored[normalised] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("error reading alpha key cache [%s]: %s", path, err)
+	}
+	return true, nil
+}
+
+// normalise returns the form of a company name by which its keys are cached: in capitals, with runs of
+// whitespace reduced to single spaces. Names differing only in these respects have the same keys.
+func normalise(name string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,166 @@
+package alphakey
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingGenerator works out keys locally, recording the names it was asked about
+type countingGenerator struct {
+	asked []string
+}
+
+func (g *countingGenerator) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+	g.asked = append(g.asked, string(companyNames))
+	return NewLocalGenerator().GetAlphaKeys(companyNames, alphaKeyURL)
+}
+
+func TestUnitCache(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alphakey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Given a cache which has seen some names", t, func() {
+
+		next := &countingGenerator{}
+		c, err := NewCache(next, "", 0, "remote")
+		So(err, ShouldBeNil)
+
+		_, err = c.GetAlphaKeys([]byte(`[{"name":"Acme Ltd"},{"name":"Widget Co"}]`), "url")
+		So(err, ShouldBeNil)
+
+		Convey("When asked about those names again, differently spaced and capitalised, and one more", func() {
+
+			keys, err := c.GetAlphaKeys([]byte(`[{"name":"WIDGET  co"},{"name":"Gadget PLC"},{"name":"acme ltd"}]`), "url")
+			So(err, ShouldBeNil)
+
+			Convey("Then only the new name should be passed on", func() {
+
+				So(next.asked, ShouldResemble, []string{
+					`[{"name":"Acme Ltd"},{"name":"Widget Co"}]`,
+					`[{"name":"Gadget PLC"}]`,
+				})
+			})
+
+			Convey("Then every key should be returned in order", func() {
+
+				So(string(keys), ShouldEqual, `[{"sameAsAlphaKey":"WIDGETCO","orderedAlphaKey":"WIDGETCO"},`+
+					`{"sameAsAlphaKey":"GADGET","orderedAlphaKey":"GADGETPLC"},`+
+					`{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"}]`)
+			})
+
+			Convey("Then the hits and misses should be counted", func() {
+
+				hits, misses := c.Stats()
+				So(hits, ShouldEqual, 2)
+				So(misses, ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Should not remember empty keys", t, func() {
+
+		next := &countingGenerator{}
+		c, _ := NewCache(next, "", 0, "remote")
+
+		_, _ = c.GetAlphaKeys([]byte(`[{"name":"!!!"}]`), "url")
+		_, _ = c.GetAlphaKeys([]byte(`[{"name":"!!!"}]`), "url")
+
+		So(next.asked, ShouldHaveLength, 2)
+	})
+
+	Convey("Should leave the keys of names empty when they cannot be matched to the keys returned", t, func() {
+
+		c, _ := NewCache(fixedGenerator{keys: `[{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"}]`}, "", 0, "remote")
+
+		keys, err := c.GetAlphaKeys([]byte(`[{"name":"Acme Ltd"},{"name":"Widget Co"}]`), "url")
+
+		So(err, ShouldBeNil)
+		So(string(keys), ShouldEqual, `[{"sameAsAlphaKey":"","orderedAlphaKey":""},{"sameAsAlphaKey":"","orderedAlphaKey":""}]`)
+		So(c.(*Cached).keys, ShouldBeEmpty)
+	})
+
+	Convey("Given a cache limited in size", t, func() {
+
+		next := &countingGenerator{}
+		c, _ := NewCache(next, "", 1, "remote")
+
+		_, _ = c.GetAlphaKeys([]byte(`[{"name":"Acme Ltd"},{"name":"Widget Co"}]`), "url")
+
+		Convey("Then it should hold no more keys than its size", func() {
+
+			So(c.(*Cached).keys, ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Given a cache kept in a file", t, func() {
+
+		path := filepath.Join(dir, "alphaKeys.ndjson")
+
+		c, err := NewCache(&countingGenerator{}, path, 0, "remote")
+		So(err, ShouldBeNil)
+		_, err = c.GetAlphaKeys([]byte(`[{"name":"Acme Ltd"}]`), "url")
+		So(err, ShouldBeNil)
+		So(c.Close(), ShouldBeNil)
+
+		Convey("Then the next run should find the keys it cached", func() {
+
+			next := &countingGenerator{}
+			c, err := NewCache(next, path, 0, "remote")
+			So(err, ShouldBeNil)
+			defer c.Close()
+
+			_, err = c.GetAlphaKeys([]byte(`[{"name":"Acme Ltd"}]`), "url")
+			So(err, ShouldBeNil)
+			So(next.asked, ShouldBeEmpty)
+		})
+
+		Convey("Then only its owner should be able to read it", func() {
+
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		})
+
+		Convey("Then a run taking keys from another source should refuse it", func() {
+
+			_, err := NewCache(&countingGenerator{}, path, 0, "local")
+			So(err.Error(), ShouldEqual, "alpha key cache ["+path+"] holds keys from the [remote] source, not [local]")
+		})
+	})
+
+	Convey("Should refuse a cache file which does not record its source", t, func() {
+
+		path := filepath.Join(dir, "unheaded.ndjson")
+		So(ioutil.WriteFile(path, []byte(`{"name":"ACME LTD","key":{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"}}`+"\n"), 0644), ShouldBeNil)
+
+		_, err := NewCache(&countingGenerator{}, path, 0, "remote")
+		So(err.Error(), ShouldEqual, "alpha key cache ["+path+"] does not record the source of its keys, delete it to start afresh")
+	})
+
+	Convey("Should write each name to the cache file once, however often it is evicted and fetched again", t, func() {
+
+		path := filepath.Join(dir, "evicting.ndjson")
+
+		next := &countingGenerator{}
+		c, err := NewCache(next, path, 1, "remote")
+		So(err, ShouldBeNil)
+		for i := 0; i < 3; i++ {
+			_, err = c.GetAlphaKeys([]byte(`[{"name":"Acme Ltd"},{"name":"Widget Co"}]`), "url")
+			So(err, ShouldBeNil)
+		}
+		So(c.Close(), ShouldBeNil)
+
+		b, _ := ioutil.ReadFile(path)
+		So(string(b), ShouldEqual, `{"source":"remote"}`+"\n"+
+			`{"name":"Acme Ltd","key":{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"}}`+"\n"+
+			`{"name":"Widget Co","key":{"sameAsAlphaKey":"WIDGETCO","orderedAlphaKey":"WIDGETCO"}}`+"\n")
+	})
+}
@@ -0,0 +1,93 @@
+package alphakey
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+)
+
+// Comparison provides an implementation of the Generator interface which returns the keys of one Generator
+// while checking them against those of another, reporting every company name sampled on which they differ
+type Comparison struct {
+	primary Generator
+	other   Generator
+	sample  float64
+	report  func(name string, primary datastructures.AlphaKey, other datastructures.AlphaKey)
+
+	mu  sync.Mutex
+	due float64
+}
+
+// NewComparison returns a Generator returning the keys of primary, calling report for each name to which
+// other gives different keys. Only the share of names given by sample, from 0 to 1, is compared, spread evenly
+// over the names asked about.
+func NewComparison(primary Generator, other Generator, sample float64, report func(name string, primary datastructures.AlphaKey, other datastructures.AlphaKey)) Generator {
+
+	return &Comparison{primary: primary, other: other, sample: sample, report: report}
+}
+
+// GetAlphaKeys returns the primary Generator's keys for the given company names, having compared a sample of
+// them with the other Generator's. A failure of the other Generator is logged, not returned.
+func (c *Comparison) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+
+	keys, err := c.primary.GetAlphaKeys(companyNames, alphaKeyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []datastructures.CompanyName
+	var primaryKeys []datastructures.AlphaKey
+	if json.Unmarshal(companyNames, &names) != nil || json.Unmarshal(keys, &primaryKeys) != nil || len(primaryKeys) != len(names) {
+		log.Printf("cannot compare alpha keys of %d names: got %d keys", len(names), len(primaryKeys))
+		return keys, nil
+	}
+
+	var sampled []int
+	var sampledNames []datastructures.CompanyName
+	for i, name := range names {
+		if c.sampled() {
+			sampled = append(sampled, i)
+			sampledNames = append(sampledNames, name)
+		}
+	}
+	if len(sampled) == 0 {
+		return keys, nil
+	}
+
+	body, err := json.Marshal(sampledNames)
+	if err == nil {
+		body, err = c.other.GetAlphaKeys(body, alphaKeyURL)
+	}
+	if err != nil {
+		log.Printf("error fetching alpha keys to compare: %s", err)
+		return keys, nil
+	}
+
+	var otherKeys []datastructures.AlphaKey
+	if json.Unmarshal(body, &otherKeys) != nil || len(otherKeys) != len(sampled) {
+		log.Printf("cannot compare alpha keys of %d names: got %d keys", len(sampled), len(otherKeys))
+		return keys, nil
+	}
+
+	for j, i := range sampled {
+		if primaryKeys[i] != otherKeys[j] {
+			c.report(names[i].Name, primaryKeys[i], otherKeys[j])
+		}
+	}
+	return keys, nil
+}
+
+// sampled reports whether the next name is to be compared, picking the share of names given by sample
+func (c *Comparison) sampled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.due += c.sample
+	if c.due < 1 {
+		return false
+	}
+	c.due--
+	return true
+}
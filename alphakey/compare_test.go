@@ -0,0 +1,80 @@
+package alphakey
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fixedGenerator returns the same keys, or error, whatever it is asked
+type fixedGenerator struct {
+	keys string
+	err  error
+}
+
+func (g fixedGenerator) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+	return []byte(g.keys), g.err
+}
+
+func TestUnitComparison(t *testing.T) {
+
+	names := []byte(`[{"name":"Acme Ltd"},{"name":"Widget Co"}]`)
+	remote := fixedGenerator{keys: `[{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"},{"sameAsAlphaKey":"WIDGET","orderedAlphaKey":"WIDGETCO"}]`}
+
+	type difference struct {
+		name           string
+		primary, other datastructures.AlphaKey
+	}
+	var differences []difference
+	report := func(name string, primary datastructures.AlphaKey, other datastructures.AlphaKey) {
+		differences = append(differences, difference{name, primary, other})
+	}
+
+	Convey("Should return the primary keys, reporting the names given different keys by the other", t, func() {
+
+		differences = nil
+
+		keys, err := NewComparison(remote, NewLocalGenerator(), 1, report).GetAlphaKeys(names, "url")
+
+		So(err, ShouldBeNil)
+		So(string(keys), ShouldEqual, remote.keys)
+		So(differences, ShouldResemble, []difference{{
+			name:    "Widget Co",
+			primary: datastructures.AlphaKey{SameAsAlphaKey: "WIDGET", OrderedAlphaKey: "WIDGETCO"},
+			other:   datastructures.AlphaKey{SameAsAlphaKey: "WIDGETCO", OrderedAlphaKey: "WIDGETCO"},
+		}})
+	})
+
+	Convey("Should compare only the sampled share of names", t, func() {
+
+		differences = nil
+		c := NewComparison(remote, NewLocalGenerator(), 0.5, report)
+
+		for i := 0; i < 2; i++ {
+			keys, err := c.GetAlphaKeys(names, "url")
+			So(err, ShouldBeNil)
+			So(string(keys), ShouldEqual, remote.keys)
+		}
+		So(differences, ShouldHaveLength, 2)
+	})
+
+	Convey("Should return the primary keys when the other fails", t, func() {
+
+		differences = nil
+
+		keys, err := NewComparison(remote, fixedGenerator{err: errors.New("connection refused")}, 1, report).GetAlphaKeys(names, "url")
+
+		So(err, ShouldBeNil)
+		So(string(keys), ShouldEqual, remote.keys)
+		So(differences, ShouldBeEmpty)
+	})
+
+	Convey("Should fail when the primary fails", t, func() {
+
+		_, err := NewComparison(fixedGenerator{err: errors.New("connection refused")}, NewLocalGenerator(), 1, report).GetAlphaKeys(names, "url")
+
+		So(err.Error(), ShouldEqual, "connection refused")
+	})
+}
@@ -0,0 +1,2 @@
+// Package alphakey provides the alpha keys by which company names are ordered and compared for similarity
+package alphakey
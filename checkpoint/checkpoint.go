@@ -0,0 +1,126 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Tracker provides an interface by which to record the progress of a load through a cursor sorted by _id
+type Tracker interface {
+	Add(lastID string) int
+	Confirm(seq int)
+	Last() string
+	Complete() bool
+}
+
+// Track provides a concrete implementation of the Tracker interface
+type Track struct {
+	mu        sync.Mutex
+	path      string
+	last      string
+	next      int
+	done      int
+	ids       map[int]string
+	confirmed map[int]bool
+}
+
+// Function variables to facilitate testing.
+var (
+	readFile  = ioutil.ReadFile
+	writeFile = ioutil.WriteFile
+	rename    = os.Rename
+)
+
+// NewTracker returns a concrete implementation of the Tracker interface which persists the
+// last confirmed _id to the file at path, starting from the given last _id
+func NewTracker(path string, last string) Tracker {
+
+	return &Track{
+		path:      path,
+		last:      last,
+		ids:       make(map[int]string),
+		confirmed: make(map[int]bool),
+	}
+}
+
+// Load returns the _id recorded in the checkpoint file at path, or an empty string if there is no such file
+func Load(path string) (string, error) {
+	b, err := readFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Save writes value to the file at path, by way of a temporary file which is renamed into place so that an
+// interrupted write never leaves a truncated file behind
+func Save(path string, value string) error {
+	tmp := path + ".tmp"
+	if err := writeFile(tmp, []byte(value+"\n"), 0600); err != nil {
+		return err
+	}
+	return rename(tmp, path)
+}
+
+// Add registers a batch ending in lastID and returns the sequence number with which to confirm it.
+// Batches must be added in cursor order.
+func (t *Track) Add(lastID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seq := t.next
+	t.ids[seq] = lastID
+	t.next++
+	return seq
+}
+
+// Confirm marks the batch with the given sequence number as fully acknowledged. The checkpoint only
+// advances once every batch added before it has also been confirmed.
+func (t *Track) Confirm(seq int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.confirmed[seq] = true
+
+	advanced := false
+	for t.confirmed[t.done] {
+		t.last = t.ids[t.done]
+		delete(t.ids, t.done)
+		delete(t.confirmed, t.done)
+		t.done++
+		advanced = true
+	}
+
+	if advanced {
+		t.save()
+	}
+}
+
+// Last returns the last _id up to which every batch has been confirmed
+func (t *Track) Last() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.last
+}
+
+// Complete reports whether every batch added has been confirmed
+func (t *Track) Complete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.done == t.next
+}
+
+// save persists the checkpoint, logging rather than failing the load if it cannot
+func (t *Track) save() {
+	if err := Save(t.path, t.last); err != nil {
+		log.Printf("error writing checkpoint [%s] to file: [%s]: %s", t.last, t.path, err)
+	}
+}
@@ -0,0 +1,104 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitLoad(t *testing.T) {
+
+	Convey("Given there is no checkpoint file", t, func() {
+
+		dir, _ := ioutil.TempDir("", "checkpoint")
+		defer os.RemoveAll(dir)
+
+		Convey("When Load is called", func() {
+
+			last, err := Load(filepath.Join(dir, "missing.txt"))
+
+			Convey("Then an empty _id should be returned without error", func() {
+
+				So(last, ShouldEqual, "")
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a checkpoint file containing an _id", t, func() {
+
+		dir, _ := ioutil.TempDir("", "checkpoint")
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "checkpoint.txt")
+		_ = ioutil.WriteFile(path, []byte("00006400\n"), 0600)
+
+		Convey("When Load is called", func() {
+
+			last, err := Load(path)
+
+			Convey("Then the trimmed _id should be returned", func() {
+
+				So(last, ShouldEqual, "00006400")
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestUnitConfirm(t *testing.T) {
+
+	Convey("Given three batches have been added to a tracker", t, func() {
+
+		dir, _ := ioutil.TempDir("", "checkpoint")
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "checkpoint.txt")
+		tracker := NewTracker(path, "00000001")
+
+		first := tracker.Add("00000100")
+		second := tracker.Add("00000200")
+		third := tracker.Add("00000300")
+
+		Convey("When a later batch is confirmed before an earlier one", func() {
+
+			tracker.Confirm(second)
+
+			Convey("Then the checkpoint should not advance", func() {
+
+				So(tracker.Last(), ShouldEqual, "00000001")
+
+				last, _ := Load(path)
+				So(last, ShouldEqual, "")
+			})
+
+			Convey("And when the earlier batch is confirmed", func() {
+
+				tracker.Confirm(first)
+
+				Convey("Then the checkpoint should advance past both batches", func() {
+
+					So(tracker.Last(), ShouldEqual, "00000200")
+					So(tracker.Complete(), ShouldBeFalse)
+
+					last, _ := Load(path)
+					So(last, ShouldEqual, "00000200")
+				})
+
+				Convey("And when the final batch is confirmed the checkpoint should reach it", func() {
+
+					tracker.Confirm(third)
+
+					So(tracker.Last(), ShouldEqual, "00000300")
+					So(tracker.Complete(), ShouldBeTrue)
+
+					last, _ := Load(path)
+					So(last, ShouldEqual, "00000300")
+				})
+			})
+		})
+	})
+}
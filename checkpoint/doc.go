@@ -0,0 +1,2 @@
+// Package checkpoint provides a means of recording how far a load has progressed through a source collection
+package checkpoint
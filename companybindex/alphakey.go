@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/alphakey"
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+)
+
+const (
+	alphaKeySourceRemote  = "remote"
+	alphaKeySourceLocal   = "local"
+	alphaKeySourceCompare = "compare"
+)
+
+var (
+	alphaKeySource    = alphaKeySourceRemote
+	alphaKeySample    = 0.01
+	alphaKeyCacheOn   = true
+	alphaKeyCacheSize = 1000000
+	alphaKeyCacheFile = ""
+	alphaKeyBatchSize = 500
+	alphaKeyWorkers   = 5
+	alphaKeyLinger    = 50 * time.Millisecond
+)
+
+// alphaKeyCache remembers alpha keys already fetched, unless -alphakey-cache=false.
+var alphaKeyCache alphakey.Cache
+
+// alphaKeyGenerator provides the alpha keys of company names, once configured from the flags.
+var alphaKeyGenerator alphakey.Generator = alphakey.NewLocalGenerator()
+
+// alphaKeyFallback provides the alpha keys of single company names which alphaKeyGenerator failed to key, once
+// configured from the flags. It asks the chosen source directly, bypassing the cache and batching.
+var alphaKeyFallback alphakey.Generator = alphakey.NewLocalGenerator()
+
+// newAlphaKeyGenerator returns the alphakey.Generator chosen by -alphakey-source, consulting alphaKeyCache
+// first if -alphakey-cache is set. A comparison is never cached, as only the names missing from the cache would
+// be compared.
+func newAlphaKeyGenerator(w write.Writer) alphakey.Generator {
+	client := eshttp.NewClientWithRetryPolicy(w, alphaKeyRequester, retryPolicy)
+	g := alphaKeySourceGenerator(alphakey.NewBatcher(client, alphaKeyBatchSize, alphaKeyWorkers, alphaKeyLinger))
+	if !alphaKeyCacheOn {
+		return g
+	}
+	if alphaKeySource == alphaKeySourceCompare {
+		log.Printf("not caching alpha keys, so that names seen before can still be compared")
+		return g
+	}
+
+	var err error
+	if alphaKeyCache, err = alphakey.NewCache(g, alphaKeyCacheFile, alphaKeyCacheSize, alphaKeySource); err != nil {
+		fatalf("error creating alpha key cache: %s", err)
+	}
+	return alphaKeyCache
+}
+
+// newAlphaKeyFallback returns the alphakey.Generator chosen by -alphakey-source, asking the alphakey service
+// about each list of names as it is given, without waiting to combine it with others
+func newAlphaKeyFallback(w write.Writer) alphakey.Generator {
+	return alphaKeySourceGenerator(eshttp.NewClientWithRetryPolicy(w, alphaKeyRequester, retryPolicy))
+}
+
+// alphaKeySourceGenerator returns the alphakey.Generator chosen by -alphakey-source, asking the alphakey service
+// through remote
+func alphaKeySourceGenerator(remote alphakey.Generator) alphakey.Generator {
+	switch alphaKeySource {
+	case alphaKeySourceRemote:
+		return remote
+	case alphaKeySourceLocal:
+		return alphakey.NewLocalGenerator()
+	case alphaKeySourceCompare:
+		if alphaKeySample <= 0 || alphaKeySample > 1 {
+			fatalf("alpha key compare sample [%v] is not above 0 and at most 1", alphaKeySample)
+		}
+		return alphakey.NewComparison(remote, alphakey.NewLocalGenerator(), alphaKeySample, reportAlphaKeyDifference)
+	default:
+		fatalf("unknown alpha key source [%s]", alphaKeySource)
+		return nil
+	}
+}
+
+// reportAlphaKeyDifference logs a company name given different keys by the alphakey service and local rules
+func reportAlphaKeyDifference(name string, remote datastructures.AlphaKey, local datastructures.AlphaKey) {
+	log.Printf("alpha keys differ for [%s]: remote same-as [%s] ordered [%s], local same-as [%s] ordered [%s]",
+		name, remote.SameAsAlphaKey, remote.OrderedAlphaKey, local.SameAsAlphaKey, local.OrderedAlphaKey)
+}
+
+// alphaKeyCacheStatus returns the proportion of company names found in alphaKeyCache for the status output,
+// if caching
+func alphaKeyCacheStatus() string {
+	if alphaKeyCache == nil {
+		return ""
+	}
+	hits, misses := alphaKeyCache.Stats()
+	if hits+misses == 0 {
+		return "  ak hits:   0.0%"
+	}
+	return fmt.Sprintf("  ak hits: %5.1f%%", 100*float64(hits)/float64(hits+misses))
+}
+
+// closeAlphaKeyCache closes alphaKeyCache, if caching
+func closeAlphaKeyCache() {
+	if alphaKeyCache == nil {
+		return
+	}
+	if err := alphaKeyCache.Close(); err != nil {
+		log.Printf("error closing alpha key cache [%s]: %s", alphaKeyCacheFile, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/alphakey"
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitNewAlphaKeyGenerator(t *testing.T) {
+
+	realAlphaKeySource, realAlphaKeyCacheOn, realAlphaKeyCache := alphaKeySource, alphaKeyCacheOn, alphaKeyCache
+	defer func() {
+		alphaKeySource, alphaKeyCacheOn, alphaKeyCache = realAlphaKeySource, realAlphaKeyCacheOn, realAlphaKeyCache
+	}()
+	alphaKeyCacheOn = false
+
+	ctrl := gomock.NewController(t)
+	w := write.NewMockWriter(ctrl)
+
+	Convey("Should call the alphakey service in batches by default", t, func() {
+
+		alphaKeySource = alphaKeySourceRemote
+
+		So(newAlphaKeyGenerator(w), ShouldHaveSameTypeAs, &alphakey.Batcher{})
+	})
+
+	Convey("Should work out alpha keys locally when asked", t, func() {
+
+		alphaKeySource = alphaKeySourceLocal
+
+		So(newAlphaKeyGenerator(w), ShouldHaveSameTypeAs, &alphakey.Local{})
+	})
+
+	Convey("Should compare the alphakey service with local rules when asked", t, func() {
+
+		alphaKeySource = alphaKeySourceCompare
+
+		So(newAlphaKeyGenerator(w), ShouldHaveSameTypeAs, &alphakey.Comparison{})
+	})
+
+	Convey("Should consult the cache before the chosen source when caching", t, func() {
+
+		alphaKeySource, alphaKeyCacheOn = alphaKeySourceRemote, true
+		defer func() { alphaKeyCacheOn = false }()
+
+		g := newAlphaKeyGenerator(w)
+
+		So(g, ShouldHaveSameTypeAs, &alphakey.Cached{})
+		So(g, ShouldEqual, alphaKeyCache)
+		So(alphaKeyCacheStatus(), ShouldEqual, "  ak hits:   0.0%")
+	})
+
+	Convey("Should not cache a comparison, so that names seen before can still be compared", t, func() {
+
+		alphaKeySource, alphaKeyCacheOn, alphaKeyCache = alphaKeySourceCompare, true, nil
+		defer func() { alphaKeyCacheOn = false }()
+
+		So(newAlphaKeyGenerator(w), ShouldHaveSameTypeAs, &alphakey.Comparison{})
+		So(alphaKeyCache, ShouldBeNil)
+	})
+
+	Convey("Should ask the alphakey service directly for the keys of single names", t, func() {
+
+		alphaKeySource = alphaKeySourceRemote
+
+		So(newAlphaKeyFallback(w), ShouldHaveSameTypeAs, &eshttp.ClientImpl{})
+	})
+
+	Convey("Should exit given a compare sample which would compare no names", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		realAlphaKeySample := alphaKeySample
+		defer func() { alphaKeySample = realAlphaKeySample }()
+		alphaKeySource, alphaKeySample = alphaKeySourceCompare, 0
+
+		So(func() { newAlphaKeyGenerator(w) }, ShouldPanicWith, "alpha key compare sample [0] is not above 0 and at most 1")
+	})
+
+	Convey("Should exit given an unknown source", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		alphaKeySource = "elsewhere"
+
+		So(func() { newAlphaKeyGenerator(w) }, ShouldPanicWith, "unknown alpha key source [elsewhere]")
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+)
+
+var (
+	esAuth eshttp.Auth
+	esTLS  eshttp.TLS
+)
+
+// Function variables to facilitate testing.
+var lookupEnv = os.LookupEnv
+
+// applyAuthEnvironment fills in the Elastic Search credentials and TLS settings whose flags were not given on
+// the command line from environment variables, which keep secrets out of the process list and the flag usage output
+func applyAuthEnvironment(given map[string]bool) {
+	fromEnv(given, &esAuth.Username, "es-username", "ES_USERNAME")
+	fromEnv(given, &esAuth.Password, "es-password", "ES_PASSWORD")
+	fromEnv(given, &esAuth.APIKey, "es-api-key", "ES_API_KEY")
+	fromEnv(given, &esTLS.CAFile, "es-ca-cert", "ES_CA_CERT")
+	fromEnv(given, &esTLS.CertFile, "es-client-cert", "ES_CLIENT_CERT")
+	fromEnv(given, &esTLS.KeyFile, "es-client-key", "ES_CLIENT_KEY")
+
+	if value, ok := lookupEnv("ES_INSECURE_SKIP_VERIFY"); ok && !given["es-insecure-skip-verify"] {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			fatalf("error parsing ES_INSECURE_SKIP_VERIFY [%s]: %s", value, err)
+		}
+		esTLS.InsecureSkipVerify = insecure
+	}
+}
+
+// fromEnv sets value from the named environment variable, unless its flag was given on the command line
+func fromEnv(given map[string]bool, value *string, flagName string, name string) {
+	if env, ok := lookupEnv(name); ok && !given[flagName] {
+		*value = env
+	}
+}
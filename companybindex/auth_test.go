@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitApplyAuthEnvironment(t *testing.T) {
+
+	realAuth, realTLS, realLookupEnv := esAuth, esTLS, lookupEnv
+	defer func() { esAuth, esTLS, lookupEnv = realAuth, realTLS, realLookupEnv }()
+
+	env := map[string]string{
+		"ES_USERNAME":             "elastic",
+		"ES_PASSWORD":             "changeme",
+		"ES_CA_CERT":              "/etc/ssl/es-ca.pem",
+		"ES_INSECURE_SKIP_VERIFY": "true",
+	}
+	lookupEnv = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	Convey("Should take settings not given by flags from the environment", t, func() {
+
+		esAuth, esTLS = eshttp.Auth{}, eshttp.TLS{}
+
+		applyAuthEnvironment(map[string]bool{})
+
+		So(esAuth, ShouldResemble, eshttp.Auth{Username: "elastic", Password: "changeme"})
+		So(esTLS, ShouldResemble, eshttp.TLS{CAFile: "/etc/ssl/es-ca.pem", InsecureSkipVerify: true})
+	})
+
+	Convey("Should prefer settings given by flags to the environment", t, func() {
+
+		esAuth, esTLS = eshttp.Auth{Username: "loader"}, eshttp.TLS{CAFile: "ca.pem"}
+
+		applyAuthEnvironment(map[string]bool{"es-username": true, "es-ca-cert": true})
+
+		So(esAuth.Username, ShouldEqual, "loader")
+		So(esTLS.CAFile, ShouldEqual, "ca.pem")
+	})
+
+	Convey("Should keep certificate verification when -es-insecure-skip-verify=false is given", t, func() {
+
+		esAuth, esTLS = eshttp.Auth{}, eshttp.TLS{}
+
+		applyAuthEnvironment(map[string]bool{"es-insecure-skip-verify": true})
+
+		So(esTLS.InsecureSkipVerify, ShouldBeFalse)
+	})
+
+	Convey("Should exit when ES_INSECURE_SKIP_VERIFY is not a boolean", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		esAuth, esTLS = eshttp.Auth{}, eshttp.TLS{}
+		env["ES_INSECURE_SKIP_VERIFY"] = "sometimes"
+
+		So(func() { applyAuthEnvironment(map[string]bool{}) },
+			ShouldPanicWith,
+			`error parsing ES_INSECURE_SKIP_VERIFY [sometimes]: strconv.ParseBool: parsing "sometimes": invalid syntax`)
+	})
+}
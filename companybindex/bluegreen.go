@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// generationLayout is the timestamp suffix given to each index generation, chosen so that generations sort by name
+const generationLayout = "20060102150405"
+
+var (
+	blueGreen       = false
+	esAlias         = "alpha_search"
+	keepGenerations = 0
+)
+
+var generationSuffix = regexp.MustCompile(`^-\d{14}$`)
+
+type aliasActions struct {
+	Actions []map[string]aliasAction `json:"actions"`
+}
+
+type aliasAction struct {
+	Index string `json:"index"`
+	Alias string `json:"alias"`
+}
+
+// loadBlueGreen loads into a new index generation, leaving the index behind esAlias serving searches
+// throughout. Once the load is complete and its document count verified, the alias is moved to the new
+// generation in a single atomic update, and generations beyond keepGenerations are deleted.
+func loadBlueGreen(w write.Writer, f format.Formatter, dl write.DeadLetterWriter) {
+	c := eshttp.NewClientWithRetryPolicy(w, adminRequester, retryPolicy)
+
+	if resume {
+		// The interrupted run told us which generation it was loading; carry on loading into that.
+		if !isGeneration(esAlias, esDestIndex) {
+			fatalf("resuming a blue-green load needs -es-dest-index naming the %s-%s generation being loaded, not [%s]", esAlias, generationLayout, esDestIndex)
+		}
+	} else {
+		esDestIndex = esAlias + "-" + now().UTC().Format(generationLayout)
+		createIndexFromScheme(c, esDestIndex)
+	}
+
+	if !load(w, f, dl, bson.D{}) {
+		fatalf("not every batch was loaded into [%s], alias [%s] left unchanged", esDestIndex, esAlias)
+	}
+
+	verifyCount(c, esDestIndex, totals.written)
+	moveAlias(c, esAlias, esDestIndex)
+
+	if keepGenerations > 0 {
+		deleteOldGenerations(c, esAlias, esDestIndex, keepGenerations)
+	}
+}
+
+// verifyCount exits unless index holds the number of documents written to it. A resumed load only knows
+// what it wrote itself, so the index may hold more.
+func verifyCount(c eshttp.Client, index string, written int) {
+	if err := c.Refresh(esDestURL, index); err != nil {
+		fatalf("error refreshing index [%s]: %s", index, err)
+	}
+
+	count, err := c.Count(esDestURL, index)
+	if err != nil {
+		fatalf("error counting documents in index [%s]: %s", index, err)
+	}
+
+	if count < written || (!resume && count != written) {
+		fatalf("index [%s] holds %d documents but %d were written, alias [%s] left unchanged", index, count, written, esAlias)
+	}
+	log.Printf("index [%s] holds %d documents", index, count)
+}
+
+// moveAlias points alias at index alone, removing it from whichever indices it pointed at before
+func moveAlias(c eshttp.Client, alias string, index string) {
+	previous, err := c.GetAliasIndices(esDestURL, alias)
+	if err != nil {
+		fatalf("error finding indices behind alias [%s]: %s", alias, err)
+	}
+
+	var actions aliasActions
+	for _, p := range previous {
+		actions.Actions = append(actions.Actions, map[string]aliasAction{"remove": {Index: p, Alias: alias}})
+	}
+	actions.Actions = append(actions.Actions, map[string]aliasAction{"add": {Index: index, Alias: alias}})
+
+	body, err := marshal(actions)
+	if err != nil {
+		fatalf("error marshal to json: %s", err)
+	}
+
+	if err := c.UpdateAliases(esDestURL, body); err != nil {
+		fatalf("error moving alias [%s] to index [%s]: %s", alias, index, err)
+	}
+	log.Printf("alias [%s] moved from %v to [%s]", alias, previous, index)
+}
+
+// deleteOldGenerations deletes all but the newest keep generations of the alias's indices, never deleting current
+func deleteOldGenerations(c eshttp.Client, alias string, current string, keep int) {
+	indices, err := c.GetIndices(esDestURL, alias+"-*")
+	if err != nil {
+		fatalf("error listing generations of [%s]: %s", alias, err)
+	}
+
+	var generations []string
+	for _, index := range indices {
+		if isGeneration(alias, index) {
+			generations = append(generations, index)
+		}
+	}
+
+	for i := 0; i < len(generations)-keep; i++ {
+		if generations[i] == current {
+			continue
+		}
+		if err := c.DeleteIndex(esDestURL, generations[i]); err != nil {
+			log.Printf("error deleting old generation [%s]: %s", generations[i], err)
+			continue
+		}
+		log.Printf("deleted old generation [%s]", generations[i])
+	}
+}
+
+// isGeneration reports whether index is one of the timestamped generations created for alias
+func isGeneration(alias string, index string) bool {
+	return strings.HasPrefix(index, alias) && generationSuffix.MatchString(strings.TrimPrefix(index, alias))
+}
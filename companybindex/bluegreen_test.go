@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitMoveAlias(t *testing.T) {
+
+	Convey("Should atomically move the alias from the previous generation to the new one", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().GetAliasIndices(esDestURL, "alpha_search").Return([]string{"alpha_search-20261017000000"}, nil)
+		client.EXPECT().UpdateAliases(esDestURL, []byte(`{"actions":[`+
+			`{"remove":{"index":"alpha_search-20261017000000","alias":"alpha_search"}},`+
+			`{"add":{"index":"alpha_search-20261018000000","alias":"alpha_search"}}]}`)).Return(nil)
+
+		moveAlias(client, "alpha_search", "alpha_search-20261018000000")
+	})
+
+	Convey("Should create the alias when it does not exist yet", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().GetAliasIndices(esDestURL, "alpha_search").Return(nil, nil)
+		client.EXPECT().UpdateAliases(esDestURL, []byte(`{"actions":[`+
+			`{"add":{"index":"alpha_search-20261018000000","alias":"alpha_search"}}]}`)).Return(nil)
+
+		moveAlias(client, "alpha_search", "alpha_search-20261018000000")
+	})
+}
+
+func TestUnitDeleteOldGenerations(t *testing.T) {
+
+	Convey("Should delete all but the newest generations, leaving other indices alone", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().GetIndices(esDestURL, "alpha_search-*").Return([]string{
+			"alpha_search-20261016000000",
+			"alpha_search-20261017000000",
+			"alpha_search-20261018000000",
+			"alpha_search-test",
+		}, nil)
+		client.EXPECT().DeleteIndex(esDestURL, "alpha_search-20261016000000").Return(nil).Times(1)
+
+		deleteOldGenerations(client, "alpha_search", "alpha_search-20261018000000", 2)
+	})
+}
+
+func TestUnitVerifyCount(t *testing.T) {
+
+	Convey("Should exit rather than move the alias when documents are missing", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().Refresh(esDestURL, "alpha_search-20261018000000").Return(nil)
+		client.EXPECT().Count(esDestURL, "alpha_search-20261018000000").Return(99, nil)
+
+		So(func() { verifyCount(client, "alpha_search-20261018000000", 100) },
+			ShouldPanicWith,
+			"index [alpha_search-20261018000000] holds 99 documents but 100 were written, alias [alpha_search] left unchanged")
+	})
+
+	Convey("Should accept an index holding every document written", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().Refresh(esDestURL, "alpha_search-20261018000000").Return(nil)
+		client.EXPECT().Count(esDestURL, "alpha_search-20261018000000").Return(100, nil)
+
+		So(func() { verifyCount(client, "alpha_search-20261018000000", 100) }, ShouldNotPanic)
+	})
+}
+
+func TestUnitIsGeneration(t *testing.T) {
+
+	Convey("Should recognise only timestamped generations of the alias", t, func() {
+
+		So(isGeneration("alpha_search", "alpha_search-20261018000000"), ShouldBeTrue)
+		So(isGeneration("alpha_search", "alpha_search"), ShouldBeFalse)
+		So(isGeneration("alpha_search", "alpha_search-test"), ShouldBeFalse)
+		So(isGeneration("alpha_search", "other-20261018000000"), ShouldBeFalse)
+	})
+}
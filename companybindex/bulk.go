@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+)
+
+// bulkItem holds a single document, and the action line which precedes it, ready to be sent to
+// Elasticsearch as part of a bulk request
+type bulkItem struct {
+	id     string
+	action []byte
+	source []byte
+}
+
+// newBulkItem returns a bulkItem which will perform the given action on the document with the given ID
+func newBulkItem(action string, id string, source []byte) bulkItem {
+	return bulkItem{
+		id:     id,
+		action: []byte("{ \"" + action + "\": { \"_id\": \"" + id + "\" } }\n"),
+		source: source,
+	}
+}
+
+// newDeleteBulkItem returns a bulkItem which will delete the document with the given ID. Unlike other
+// actions, a delete has no document following its action line.
+func newDeleteBulkItem(id string) bulkItem {
+	return bulkItem{
+		id:     id,
+		action: []byte("{ \"delete\": { \"_id\": \"" + id + "\" } }\n"),
+	}
+}
+
+// deadLetterBulkItem returns the bulkItem from which a DeadLetter was recorded
+func deadLetterBulkItem(deadLetter datastructures.DeadLetter) bulkItem {
+	item := bulkItem{
+		id:     deadLetter.ID,
+		action: append(append([]byte{}, deadLetter.Action...), '\n'),
+	}
+	if len(deadLetter.Document) > 0 && string(deadLetter.Document) != "null" {
+		item.source = deadLetter.Document
+	}
+	return item
+}
+
+// deadLetter returns a DeadLetter recording that the item failed with the given status and reason
+func (item bulkItem) deadLetter(status int, reason string) datastructures.DeadLetter {
+	return datastructures.DeadLetter{
+		ID:        item.id,
+		Action:    json.RawMessage(bytes.TrimSpace(item.action)),
+		Document:  json.RawMessage(item.source),
+		Reason:    reason,
+		Status:    status,
+		Timestamp: now(),
+	}
+}
+
+// bulkBody returns the NDJSON body of a bulk request made up of the given items
+func bulkBody(items []bulkItem) []byte {
+	var bulk []byte
+	for _, item := range items {
+		bulk = append(bulk, item.action...)
+		if item.source != nil {
+			bulk = append(bulk, item.source...)
+			bulk = append(bulk, []byte("\n")...)
+		}
+	}
+	return bulk
+}
+
+// size returns the number of bytes the item adds to the body of a bulk request
+func (item bulkItem) size() int {
+	if item.source == nil {
+		return len(item.action)
+	}
+	return len(item.action) + len(item.source) + 1
+}
+
+// splitBulk divides items into consecutive bulks of at most maxDocs items whose bodies total at most maxBytes,
+// a limit of zero or less being no limit. An item too big for maxBytes on its own is given a bulk to itself.
+func splitBulk(items []bulkItem, maxDocs int, maxBytes int) [][]bulkItem {
+	var bulks [][]bulkItem
+	start, bytes := 0, 0
+	for i, item := range items {
+		full := (maxDocs > 0 && i-start >= maxDocs) || (maxBytes > 0 && bytes+item.size() > maxBytes)
+		if full && i > start {
+			bulks = append(bulks, items[start:i])
+			start, bytes = i, 0
+		}
+		bytes += item.size()
+	}
+	if start < len(items) {
+		bulks = append(bulks, items[start:])
+	}
+	return bulks
+}
+
+// bulkBuilder gathers the items of successive pages into bulks, so that bulks fill up to -bulk-max-docs and
+// -bulk-max-bytes whatever the size of a page. Each page is reported done once every one of its items has been
+// sent, in whichever bulks they went.
+type bulkBuilder struct {
+	mu    sync.Mutex
+	items []bulkItem
+	pages []*bulkPage
+}
+
+// bulkPage tracks the items of a page still to be sent, and whether all those sent were accounted for
+type bulkPage struct {
+	pending int
+	ok      bool
+	done    func(ok bool)
+}
+
+// pageBulk holds the items of a bulk along with the page each came from
+type pageBulk struct {
+	items []bulkItem
+	pages []*bulkPage
+}
+
+// newBulkBuilder returns an empty bulkBuilder
+func newBulkBuilder() *bulkBuilder {
+
+	return &bulkBuilder{}
+}
+
+// add appends the items of a page, returning the bulks they have filled. done is called with whether every item
+// was accounted for once the last of them is acknowledged, or at once if there are no items.
+func (b *bulkBuilder) add(items []bulkItem, done func(ok bool)) []pageBulk {
+	if len(items) == 0 {
+		done(true)
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	page := &bulkPage{pending: len(items), ok: true, done: done}
+	for _, item := range items {
+		b.items = append(b.items, item)
+		b.pages = append(b.pages, page)
+	}
+
+	var full []pageBulk
+	start := 0
+	for _, bulk := range splitBulk(b.items, bulkMaxDocs, bulkMaxBytes) {
+		// The last bulk may yet take items from the next page, unless it already holds all it can.
+		if start+len(bulk) == len(b.items) && (bulkMaxDocs <= 0 || len(bulk) < bulkMaxDocs) {
+			break
+		}
+		full = append(full, pageBulk{items: bulk, pages: b.pages[start : start+len(bulk)]})
+		start += len(bulk)
+	}
+	b.items = append([]bulkItem(nil), b.items[start:]...)
+	b.pages = append([]*bulkPage(nil), b.pages[start:]...)
+	return full
+}
+
+// flush returns the items not yet sent as a bulk of their own, if there are any
+func (b *bulkBuilder) flush() []pageBulk {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.items) == 0 {
+		return nil
+	}
+	bulk := pageBulk{items: b.items, pages: b.pages}
+	b.items, b.pages = nil, nil
+	return []pageBulk{bulk}
+}
+
+// acknowledge records that the items of bulk were sent, and whether they were all accounted for, calling the
+// done func of each page which has no items left to send
+func (b *bulkBuilder) acknowledge(bulk pageBulk, ok bool) {
+	var done []*bulkPage
+
+	b.mu.Lock()
+	for _, page := range bulk.pages {
+		page.ok = page.ok && ok
+		page.pending--
+		if page.pending == 0 {
+			done = append(done, page)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, page := range done {
+		page.done(page.ok)
+	}
+}
+
+// bulkCompanyNumbers returns the IDs of the given items in the form logged by the write.Writer
+func bulkCompanyNumbers(items []bulkItem) []byte {
+	var companyNumbers []byte
+	for _, item := range items {
+		companyNumbers = append(companyNumbers, []byte("\n"+item.id+"")...)
+	}
+	return companyNumbers
+}
+
+// ---------------------------------------------------------------------------
+
+type esBulkResponse struct {
+	Took   int                  `json:"took"`
+	Errors bool                 `json:"errors"`
+	Items  []esBulkItemResponse `json:"items"`
+}
+
+type esBulkItemResponse map[string]esBulkItemResponseData
+
+type esBulkItemResponseData struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  esBulkItemError `json:"error"`
+}
+
+type esBulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// result returns the outcome of a bulk item, whichever action was performed
+func (r esBulkItemResponse) result() esBulkItemResponseData {
+	for _, data := range r {
+		return data
+	}
+	return esBulkItemResponseData{}
+}
+
+// succeeded reports whether a bulk item achieved what it was sent for. Deleting a document which is already
+// gone leaves nothing to do, so its 404 counts as success. So does the 409 of creating a document which already
+// exists, as it does when a resumed load rereads batches written after its checkpoint.
+func (r esBulkItemResponse) succeeded() bool {
+	status := r.result().Status
+	if _, ok := r["delete"]; ok && status == 404 {
+		return true
+	}
+	if _, ok := r["create"]; ok && status == 409 {
+		return true
+	}
+	return status < 300
+}
+
+// retryable reports whether a bulk item failed for reasons that sending it again may resolve, as opposed to
+// a permanent failure such as a mapping or parse error
+func (d esBulkItemResponseData) retryable() bool {
+	return d.Status == 429 || d.Status == 503
+}
+
+func (e esBulkItemError) String() string {
+	if e.Reason == "" {
+		return e.Type
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Reason)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+)
+
+var (
+	indexScheme = "config/search_scheme.json"
+	deleteIndex = false
+	createIndex = false
+)
+
+// prepareIndex deletes and/or creates esDestIndex before a load, as requested by the -delete-index and
+// -create-index flags
+func prepareIndex(c eshttp.Client) {
+	if deleteIndex {
+		deleteIndexIfExists(c, esDestIndex)
+	}
+	if createIndex {
+		createIndexFromScheme(c, esDestIndex)
+	}
+}
+
+// deleteIndexIfExists deletes an index, doing nothing if there is no such index
+func deleteIndexIfExists(c eshttp.Client, index string) {
+	exists, err := c.IndexExists(esDestURL, index)
+	if err != nil {
+		fatalf("error checking whether index [%s] exists: %s", index, err)
+	}
+	if !exists {
+		log.Printf("index [%s] does not exist, nothing to delete", index)
+		return
+	}
+
+	if err := c.DeleteIndex(esDestURL, index); err != nil {
+		fatalf("error deleting index [%s]: %s", index, err)
+	}
+	log.Printf("deleted index [%s]", index)
+}
+
+// createIndexFromScheme creates an index using the settings and mappings in the indexScheme file
+func createIndexFromScheme(c eshttp.Client, index string) {
+	scheme, err := readFile(indexScheme)
+	if err != nil {
+		fatalf("error reading index scheme [%s]: %s", indexScheme, err)
+	}
+	if !json.Valid(scheme) {
+		fatalf("index scheme [%s] is not valid JSON", indexScheme)
+	}
+
+	exists, err := c.IndexExists(esDestURL, index)
+	if err != nil {
+		fatalf("error checking whether index [%s] exists: %s", index, err)
+	}
+	if exists {
+		fatalf("cannot create index [%s]: it already exists, add -delete-index to replace it", index)
+	}
+
+	if err := c.CreateIndex(esDestURL, index, scheme); err != nil {
+		fatalf("error creating index [%s] from [%s]: %s", index, indexScheme, err)
+	}
+	log.Printf("created index [%s] from [%s]", index, indexScheme)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitPrepareIndex(t *testing.T) {
+
+	realDeleteIndex, realCreateIndex := deleteIndex, createIndex
+	defer func() { deleteIndex, createIndex = realDeleteIndex, realCreateIndex }()
+
+	scheme := []byte(`{"settings":{},"mappings":{}}`)
+
+	Convey("Should delete the existing index and create it afresh from the scheme", t, func() {
+
+		restoreReadFile := stubReadFile(scheme, nil)
+		defer restoreReadFile()
+
+		deleteIndex, createIndex = true, true
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		gomock.InOrder(
+			client.EXPECT().IndexExists(esDestURL, esDestIndex).Return(true, nil),
+			client.EXPECT().DeleteIndex(esDestURL, esDestIndex).Return(nil),
+			client.EXPECT().IndexExists(esDestURL, esDestIndex).Return(false, nil),
+			client.EXPECT().CreateIndex(esDestURL, esDestIndex, scheme).Return(nil),
+		)
+
+		prepareIndex(client)
+	})
+
+	Convey("Should do nothing to the index unless asked", t, func() {
+
+		deleteIndex, createIndex = false, false
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		prepareIndex(client)
+	})
+
+	Convey("Should exit when Elastic Search rejects the mapping", t, func() {
+
+		restoreReadFile := stubReadFile(scheme, nil)
+		defer restoreReadFile()
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		deleteIndex, createIndex = false, true
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().IndexExists(esDestURL, esDestIndex).Return(false, nil)
+		client.EXPECT().CreateIndex(esDestURL, esDestIndex, scheme).
+			Return(errors.New("mapper_parsing_exception: Failed to parse mapping"))
+
+		So(func() { prepareIndex(client) },
+			ShouldPanicWith,
+			"error creating index ["+esDestIndex+"] from ["+indexScheme+"]: mapper_parsing_exception: Failed to parse mapping")
+	})
+
+	Convey("Should exit before contacting Elastic Search when the scheme is not valid JSON", t, func() {
+
+		restoreReadFile := stubReadFile([]byte(`{"settings":`), nil)
+		defer restoreReadFile()
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		deleteIndex, createIndex = false, true
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		So(func() { prepareIndex(client) },
+			ShouldPanicWith,
+			"index scheme ["+indexScheme+"] is not valid JSON")
+	})
+
+	Convey("Should refuse to create an index which already exists", t, func() {
+
+		restoreReadFile := stubReadFile(scheme, nil)
+		defer restoreReadFile()
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		deleteIndex, createIndex = false, true
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().IndexExists(esDestURL, esDestIndex).Return(true, nil)
+
+		So(func() { prepareIndex(client) },
+			ShouldPanicWith,
+			"cannot create index ["+esDestIndex+"]: it already exists, add -delete-index to replace it")
+	})
+}
+
+func stubReadFile(contents []byte, err error) func() {
+	// Stub out ioutil.ReadFile
+	realReadFile := readFile
+	readFile = func(filename string) ([]byte, error) {
+		return contents, err
+	}
+	// Return function to restore ioutil.ReadFile
+	return func() { readFile = realReadFile }
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+)
+
+// loader describes a kind of document which can be loaded: the collection its source documents are read from,
+// the index and type its documents are written to, the scheme of that index and how its documents are built.
+// Documents are built by the built in company transformation if there is no field mapping. Each kind has its
+// own blue-green alias and files recording its progress, so that loading one never disturbs another.
+type loader struct {
+	database     string
+	collection   string
+	index        string
+	documentType string
+	indexScheme  string
+	fieldMapping string
+
+	alias                     string
+	checkpointFile            string
+	incrementalCheckpointFile string
+	highWaterMarkFile         string
+	resumeTokenFile           string
+	tunedSettingsFile         string
+	deadLetterFile            string
+}
+
+// loaders holds the kinds of document which can be loaded, by -type.
+var loaders = map[string]loader{
+	"company": {
+		database:     "company_profile",
+		collection:   "company_profile",
+		index:        "companies",
+		documentType: "company",
+		indexScheme:  "config/search_scheme.json",
+
+		alias:                     "alpha_search",
+		checkpointFile:            "checkpoint.txt",
+		incrementalCheckpointFile: "incrementalCheckpoint.txt",
+		highWaterMarkFile:         "highWaterMark.txt",
+		resumeTokenFile:           "resumeToken.json",
+		tunedSettingsFile:         "tunedSettings.json",
+		deadLetterFile:            "errors/deadLetter.ndjson",
+	},
+	"officer": {
+		database:     "appointments",
+		collection:   "appointments",
+		index:        "officers",
+		documentType: "officer",
+		indexScheme:  "config/officer_search_scheme.json",
+		fieldMapping: "config/officer_mapping.json",
+
+		alias:                     "officer_search",
+		checkpointFile:            "officerCheckpoint.txt",
+		incrementalCheckpointFile: "officerIncrementalCheckpoint.txt",
+		highWaterMarkFile:         "officerHighWaterMark.txt",
+		resumeTokenFile:           "officerResumeToken.json",
+		tunedSettingsFile:         "officerTunedSettings.json",
+		deadLetterFile:            "errors/officerDeadLetter.ndjson",
+	},
+}
+
+var loaderType = "company"
+
+// applyLoader sets the flags describing what is loaded, other than those given on the command line, from the
+// loader chosen by -type
+func applyLoader(given map[string]bool) {
+	l, ok := loaders[loaderType]
+	if !ok {
+		fatalf("unknown type [%s], expected one of %s", loaderType, strings.Join(loaderTypes(), ", "))
+	}
+
+	for _, setting := range []struct {
+		flag  string
+		value *string
+		is    string
+	}{
+		{"mongo-database", &mongoDatabase, l.database},
+		{"mongo-collection", &mongoCollection, l.collection},
+		{"es-dest-index", &esDestIndex, l.index},
+		{"es-dest-type", &esDestType, l.documentType},
+		{"index-scheme", &indexScheme, l.indexScheme},
+		{"field-mapping", &fieldMappingFile, l.fieldMapping},
+		{"es-alias", &esAlias, l.alias},
+		{"checkpoint-file", &checkpointFile, l.checkpointFile},
+		{"high-water-mark-file", &highWaterMarkFile, l.highWaterMarkFile},
+		{"resume-token-file", &resumeTokenFile, l.resumeTokenFile},
+		{"tuned-settings-file", &tunedSettingsFile, l.tunedSettingsFile},
+		{"dead-letter-file", &deadLetterFile, l.deadLetterFile},
+	} {
+		if !given[setting.flag] {
+			*setting.value = setting.is
+		}
+	}
+	// Having no flag of its own, this is only used in place of a -checkpoint-file not given.
+	incrementalCheckpointFile = l.incrementalCheckpointFile
+}
+
+// loaderTypes returns the types of the loaders in alphabetical order
+func loaderTypes() []string {
+	var types []string
+	for t := range loaders {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// givenFlags returns the names of the flags given on the command line
+func givenFlags() map[string]bool {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	return given
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/transform"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitApplyLoader(t *testing.T) {
+
+	realType := loaderType
+	settings := []*string{&mongoDatabase, &mongoCollection, &esDestIndex, &esDestType, &indexScheme, &fieldMappingFile,
+		&esAlias, &checkpointFile, &incrementalCheckpointFile, &highWaterMarkFile, &resumeTokenFile, &tunedSettingsFile,
+		&deadLetterFile}
+	realSettings := make([]string, len(settings))
+	for i, setting := range settings {
+		realSettings[i] = *setting
+	}
+	defer func() {
+		loaderType = realType
+		for i, setting := range settings {
+			*setting = realSettings[i]
+		}
+	}()
+
+	Convey("Should load companies by default", t, func() {
+
+		loaderType = "company"
+		applyLoader(map[string]bool{})
+
+		So(mongoCollection, ShouldEqual, "company_profile")
+		So(esDestIndex, ShouldEqual, "companies")
+		So(indexScheme, ShouldEqual, "config/search_scheme.json")
+		So(fieldMappingFile, ShouldBeEmpty)
+		So(esAlias, ShouldEqual, "alpha_search")
+		So(checkpointFile, ShouldEqual, "checkpoint.txt")
+	})
+
+	Convey("Given officers are to be loaded into an index named on the command line", t, func() {
+
+		loaderType = "officer"
+		esDestIndex = "officers-test"
+
+		Convey("When the loader is applied", func() {
+
+			applyLoader(map[string]bool{"es-dest-index": true})
+
+			Convey("Then the officer settings should be used, other than the index", func() {
+
+				So(mongoDatabase, ShouldEqual, "appointments")
+				So(mongoCollection, ShouldEqual, "appointments")
+				So(esDestType, ShouldEqual, "officer")
+				So(indexScheme, ShouldEqual, "config/officer_search_scheme.json")
+				So(fieldMappingFile, ShouldEqual, "config/officer_mapping.json")
+				So(esDestIndex, ShouldEqual, "officers-test")
+			})
+
+			Convey("Then the company alias and the files recording company loads should be left alone", func() {
+
+				So(esAlias, ShouldEqual, "officer_search")
+				So(checkpointFile, ShouldEqual, "officerCheckpoint.txt")
+				So(incrementalCheckpointFile, ShouldEqual, "officerIncrementalCheckpoint.txt")
+				So(highWaterMarkFile, ShouldEqual, "officerHighWaterMark.txt")
+				So(resumeTokenFile, ShouldEqual, "officerResumeToken.json")
+				So(tunedSettingsFile, ShouldEqual, "officerTunedSettings.json")
+				So(deadLetterFile, ShouldEqual, "errors/officerDeadLetter.ndjson")
+			})
+		})
+	})
+
+	Convey("Should give incremental officer syncs their own checkpoint file", t, func() {
+
+		loaderType, mode = "officer", modeIncremental
+		defer func() { mode = modeLoad }()
+
+		given := map[string]bool{}
+		applyLoader(given)
+		applyModeDefaults(given)
+
+		So(checkpointFile, ShouldEqual, "officerIncrementalCheckpoint.txt")
+	})
+
+	Convey("Should give no two types the same alias or files", t, func() {
+
+		used := make(map[string]string)
+		for _, name := range loaderTypes() {
+			l := loaders[name]
+			for _, value := range []string{l.index, l.alias, l.checkpointFile, l.incrementalCheckpointFile,
+				l.highWaterMarkFile, l.resumeTokenFile, l.tunedSettingsFile, l.deadLetterFile} {
+				So(value, ShouldNotBeEmpty)
+				So(used, ShouldNotContainKey, value)
+				used[value] = name
+			}
+		}
+	})
+
+	Convey("Should exit when the type is unknown", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		loaderType = "disqualified-officer"
+
+		So(func() { applyLoader(map[string]bool{}) }, ShouldPanicWith,
+			"unknown type [disqualified-officer], expected one of company, officer")
+	})
+}
+
+func TestUnitLoaderFiles(t *testing.T) {
+
+	for _, name := range loaderTypes() {
+		l := loaders[name]
+
+		Convey("Given the files of the "+name+" loader", t, func() {
+
+			b, err := ioutil.ReadFile("../" + l.indexScheme)
+			So(err, ShouldBeNil)
+
+			var scheme struct {
+				Mappings mappingProperties `json:"mappings"`
+			}
+			So(json.Unmarshal(b, &scheme), ShouldBeNil)
+
+			if l.fieldMapping == "" {
+				return
+			}
+
+			Convey("Then every field mapped should be declared in the index scheme", func() {
+
+				m, err := transform.LoadMapping("../" + l.fieldMapping)
+				So(err, ShouldBeNil)
+
+				for _, field := range m.Fields {
+					So(scheme.Mappings.declares(field.Target), ShouldBeTrue)
+				}
+			})
+		})
+	}
+}
+
+// mappingProperties holds the fields declared by an index scheme, and those within them
+type mappingProperties struct {
+	Properties map[string]mappingProperties `json:"properties"`
+}
+
+// declares reports whether the dotted path of a field is declared
+func (p mappingProperties) declares(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		var ok bool
+		if p, ok = p.Properties[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/companieshouse/elasticsearch-data-loader/alphakey"
+	"github.com/companieshouse/elasticsearch-data-loader/checkpoint"
+	"github.com/companieshouse/elasticsearch-data-loader/concurrency"
 	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
 	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
 	"github.com/companieshouse/elasticsearch-data-loader/format"
@@ -39,93 +46,403 @@ var (
 	esDestType  = "company"
 )
 
+var (
+	checkpointFile = "checkpoint.txt"
+	resume         = false
+)
+
+const (
+	modeLoad        = "load"
+	modeReplay      = "replay"
+	modeIncremental = "incremental"
+)
+
+var (
+	mode           = modeLoad
+	deadLetterFile = "errors/deadLetter.ndjson"
+	replayFile     = ""
+)
+
+var (
+	since                     = ""
+	highWaterMarkFile         = "highWaterMark.txt"
+	incrementalCheckpointFile = "incrementalCheckpoint.txt"
+	updatedField              = "updated.at"
+	bulkAction                = "create"
+)
+
+var (
+	gzipRequests = false
+
+	// compression records how much gzip shrinks request bodies when gzipRequests is set.
+	compression eshttp.CompressionStats
+
+	// esRequester sends documents to Elastic Search, once configured from the flags. Its requests are
+	// aborted by abortRequests.
+	esRequester = eshttp.NewRequester()
+
+	// adminRequester sends Elastic Search the requests which manage indices, which must be allowed to
+	// finish, or to put an index back in order, even once documents are no longer being sent.
+	adminRequester = eshttp.NewRequester()
+
+	// maintenanceRequester sends Elastic Search the refresh and force merge which follow a tuned load, which
+	// may take far longer than any other request.
+	maintenanceRequester = eshttp.NewRequester()
+
+	// alphaKeyRequester sends requests to the alphakey service, once configured from the flags. Its requests
+	// are aborted by abortRequests.
+	alphaKeyRequester = eshttp.NewRequester()
+)
+
+var connections = eshttp.Connections{
+	RequestTimeout: 5 * time.Minute,
+	DialTimeout:    10 * time.Second,
+	IdleTimeout:    90 * time.Second,
+}
+
+var (
+	minWorkers = 2
+	maxWorkers = 10
+)
+
+var (
+	bulkMaxDocs  = 500
+	bulkMaxBytes = 5 * 1024 * 1024
+)
+
+var retryPolicy = eshttp.RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
 var (
 	syncWaitGroup sync.WaitGroup
 
 	countChannel  = make(chan int)
 	insertChannel = make(chan int)
 	skipChannel   = make(chan int)
-	semaphore     = make(chan int, 5)
+	failChannel   = make(chan int)
+
+	// workers limits how many batches are transformed and sent to Elastic Search at once.
+	workers = concurrency.NewController(5, 5)
+
+	statusStop = make(chan struct{})
+	statusDone = make(chan struct{})
+
+	// totals holds the final counts once status has finished, that is once statusDone is closed.
+	totals statusTotals
 )
 
+type statusTotals struct {
+	read    int
+	written int
+	skipped int
+	failed  int
+}
+
 // Function variables to facilitate testing.
 var (
 	marshal   = json.Marshal
 	unmarshal = json.Unmarshal
-	fatalf    = log.Fatalf
+	readFile  = ioutil.ReadFile
+	fatalf    = logFatalf
+	sleep     = time.Sleep
+	now       = time.Now
 )
 
 // ---------------------------------------------------------------------------
 
-type esBulkResponse struct {
-	Took   int                  `json:"took"`
-	Errors bool                 `json:"errors"`
-	Items  []esBulkItemResponse `json:"items"`
-}
-
-type esBulkItemResponse map[string]esBulkItemResponseData
-
-type esBulkItemResponseData struct {
-	Index  string `json:"_index"`
-	ID     string `json:"_id"`
-	Status int    `json:"status"`
-	Error  string `json:"error"`
-}
-
-// ---------------------------------------------------------------------------
-
 func main() {
+	flag.StringVar(&loaderType, "type", loaderType, "kind of documents to load: "+strings.Join(loaderTypes(), " or "))
 	flag.StringVar(&mongoURL, "mongo-url", mongoURL, "mongoDB URL")
 	flag.StringVar(&mongoDatabase, "mongo-database", mongoDatabase, "mongoDB database")
 	flag.StringVar(&mongoCollection, "mongo-collection", mongoCollection, "mongoDB collection")
 	flag.IntVar(&mongoSize, "mongo-source-size", mongoSize, "mongo page size")
-	flag.StringVar(&esDestURL, "es-dest-url", esDestURL, "elasticsearch destination URL")
+	flag.StringVar(&esDestURL, "es-dest-url", esDestURL, "elasticsearch destination URL, or comma separated URLs of several nodes")
+	flag.BoolVar(&discoverNodes, "es-discover-nodes", discoverNodes, "send requests to every node in the elasticsearch cluster, found through the given nodes")
+	flag.DurationVar(&nodeCoolOff, "es-node-cool-off", nodeCoolOff, "how long to leave an elasticsearch node which could not be reached")
 	flag.StringVar(&esDestIndex, "es-dest-index", esDestIndex, "elasticsearch destination index")
 	flag.StringVar(&esDestType, "es-dest-type", esDestType, "elasticsearch destination type")
 	flag.StringVar(&alphakeyURL, "alphakey-url", alphakeyURL, "alphakey service url")
+	flag.BoolVar(&alphaKeyCacheOn, "alphakey-cache", alphaKeyCacheOn, "remember alpha keys, fetching only those of names not seen before")
+	flag.IntVar(&alphaKeyCacheSize, "alphakey-cache-size", alphaKeyCacheSize, "most alpha keys remembered in memory, 0 for no limit")
+	flag.StringVar(&alphaKeyCacheFile, "alphakey-cache-file", alphaKeyCacheFile, "file in which to keep alpha keys between runs, none if empty")
+	flag.IntVar(&alphaKeyBatchSize, "alphakey-batch-size", alphaKeyBatchSize, "most company names sent to the alphakey service in one request")
+	flag.IntVar(&alphaKeyWorkers, "alphakey-workers", alphaKeyWorkers, "most requests in progress at once to the alphakey service")
+	flag.DurationVar(&alphaKeyLinger, "alphakey-linger", alphaKeyLinger, "how long to wait for more company names to fill a request to the alphakey service")
+	flag.StringVar(&alphaKeySource, "alphakey-source", alphaKeySource, "where alpha keys come from: the 'remote' alphakey service, 'local' rules, or 'compare' the two, using remote keys")
+	flag.Float64Var(&alphaKeySample, "alphakey-compare-sample", alphaKeySample, "share of company names, above 0 and at most 1, whose keys are compared when -alphakey-source=compare")
+	flag.StringVar(&checkpointFile, "checkpoint-file", checkpointFile, "file recording the last _id fully loaded")
+	flag.BoolVar(&resume, "resume", resume, "resume loading after the _id recorded in the checkpoint file")
+	flag.DurationVar(&connections.RequestTimeout, "http-timeout", connections.RequestTimeout, "longest any HTTP request may take, including reading its response")
+	flag.DurationVar(&connections.DialTimeout, "http-dial-timeout", connections.DialTimeout, "longest an HTTP connection may take to open")
+	flag.DurationVar(&connections.IdleTimeout, "http-idle-timeout", connections.IdleTimeout, "how long an idle HTTP connection is kept open for reuse")
+	flag.BoolVar(&gzipRequests, "gzip", gzipRequests, "gzip request bodies sent to elasticsearch")
+	flag.StringVar(&esAuth.Username, "es-username", "", "elasticsearch basic auth username, or set ES_USERNAME")
+	flag.StringVar(&esAuth.Password, "es-password", "", "elasticsearch basic auth password, or set ES_PASSWORD")
+	flag.StringVar(&esAuth.APIKey, "es-api-key", "", "elasticsearch base64 encoded API key, used in preference to basic auth, or set ES_API_KEY")
+	flag.StringVar(&esTLS.CAFile, "es-ca-cert", "", "PEM bundle of CAs trusted to sign the elasticsearch certificate, or set ES_CA_CERT")
+	flag.StringVar(&esTLS.CertFile, "es-client-cert", "", "PEM client certificate presented to elasticsearch, or set ES_CLIENT_CERT")
+	flag.StringVar(&esTLS.KeyFile, "es-client-key", "", "PEM key of the client certificate, or set ES_CLIENT_KEY")
+	flag.BoolVar(&esTLS.InsecureSkipVerify, "es-insecure-skip-verify", false, "do not verify the elasticsearch certificate, for development only, or set ES_INSECURE_SKIP_VERIFY")
+	flag.IntVar(&minWorkers, "min-workers", minWorkers, "fewest batches sent to elasticsearch concurrently, the starting point")
+	flag.IntVar(&maxWorkers, "max-workers", maxWorkers, "most batches sent to elasticsearch concurrently while it keeps up")
+	flag.IntVar(&bulkMaxDocs, "bulk-max-docs", bulkMaxDocs, "maximum documents in each bulk request, 0 for no limit")
+	flag.IntVar(&bulkMaxBytes, "bulk-max-bytes", bulkMaxBytes, "maximum size in bytes of each bulk request body, 0 for no limit")
+	flag.IntVar(&retryPolicy.MaxAttempts, "retry-max-attempts", retryPolicy.MaxAttempts, "maximum attempts at each HTTP request")
+	flag.DurationVar(&retryPolicy.BaseDelay, "retry-base-delay", retryPolicy.BaseDelay, "delay before the first retry, doubling with each attempt")
+	flag.DurationVar(&retryPolicy.MaxDelay, "retry-max-delay", retryPolicy.MaxDelay, "maximum delay between retries")
+	flag.Float64Var(&retryPolicy.Jitter, "retry-jitter", retryPolicy.Jitter, "fraction of each retry delay to randomly add or remove")
+	flag.StringVar(&mode, "mode", mode, "what to do: 'load' everything from mongoDB, sync 'incremental' changes, 'watch' for changes or 'replay' a dead-letter file")
+	flag.StringVar(&deadLetterFile, "dead-letter-file", deadLetterFile, "file in which to record documents that could not be written")
+	flag.StringVar(&replayFile, "replay-file", replayFile, "dead-letter file to resubmit in replay mode")
+	flag.StringVar(&since, "since", since, "RFC 3339 time after which changes are synced in incremental mode, defaulting to the stored high-water mark")
+	flag.StringVar(&highWaterMarkFile, "high-water-mark-file", highWaterMarkFile, "file recording when the last clean incremental sync started")
+	flag.StringVar(&updatedField, "updated-field", updatedField, "mongoDB field holding the time a document was last updated")
+	flag.StringVar(&resumeTokenFile, "resume-token-file", resumeTokenFile, "file recording the change stream position in watch mode")
+	flag.BoolVar(&blueGreen, "blue-green", blueGreen, "load into a new timestamped index and move the alias to it once verified")
+	flag.StringVar(&esAlias, "es-alias", esAlias, "elasticsearch alias moved to the new index in blue-green loads")
+	flag.StringVar(&fieldMappingFile, "field-mapping", fieldMappingFile, "file describing how documents are built from company profiles, instead of the built in transformation")
+	flag.StringVar(&indexScheme, "index-scheme", indexScheme, "file holding the settings and mappings for new indices")
+	flag.IntVar(&keepGenerations, "keep-generations", keepGenerations, "number of blue-green index generations to keep, 0 to keep them all")
+	flag.BoolVar(&deleteIndex, "delete-index", deleteIndex, "delete the destination index, if it exists, before loading")
+	flag.BoolVar(&createIndex, "create-index", createIndex, "create the destination index from the index scheme before loading")
+	flag.BoolVar(&tuneBulkLoad, "tune-bulk-load", tuneBulkLoad, "disable refresh and replicas on the destination index while loading, restoring them afterwards")
+	flag.IntVar(&forceMergeSegments, "force-merge-segments", forceMergeSegments, "force-merge a tuned index to this many segments after a complete load, 0 to skip")
+	flag.StringVar(&tunedSettingsFile, "tuned-settings-file", tunedSettingsFile, "file recording the settings to restore a tuned index to")
 	flag.Parse()
 
+	given := givenFlags()
+	applyLoader(given)
+	applyModeDefaults(given)
+	applyAuthEnvironment(given)
+	loadFieldMapping()
+	workers = concurrency.NewController(minWorkers, maxWorkers)
+
+	// Every worker may hold a connection to each service, so keep as many open between requests.
+	connections.MaxIdlePerHost = maxWorkers
+
 	w := write.NewWriter()
+	nodes := findNodes(w, newRequester(nil))
+	esRequester = pooled(newRequester(requestContext), nodes)
+	adminRequester = pooled(newRequester(nil), nodes)
+	maintenanceRequester = newMaintenanceRequester()
+	alphaKeyRequester = newAlphaKeyRequester(requestContext)
+	alphaKeyGenerator = newAlphaKeyGenerator(w)
+	alphaKeyFallback = newAlphaKeyFallback(w)
 	f := format.NewFormatter()
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongoURL))
-	if err != nil {
-		fatalf("error creating mongoDB session: %s", err)
+
+	switch mode {
+	case modeLoad:
+		dl := write.NewDeadLetterWriter(deadLetterFile)
+		if blueGreen {
+			if deleteIndex || createIndex {
+				fatalf("-delete-index and -create-index do not apply to blue-green loads, which always create a new index")
+			}
+			loadBlueGreen(w, f, dl)
+		} else {
+			prepareIndex(eshttp.NewClientWithRetryPolicy(w, adminRequester, retryPolicy))
+			load(w, f, dl, bson.D{})
+		}
+	case modeIncremental:
+		from := incrementalSince()
+		started := now()
+		// Documents loaded by an earlier run must be overwritten, not rejected as already existing.
+		bulkAction = "index"
+		dl := write.NewDeadLetterWriter(deadLetterFile)
+		if load(w, f, dl, updatedSinceFilter(from)) {
+			if err := checkpoint.Save(highWaterMarkFile, started.UTC().Format(time.RFC3339Nano)); err != nil {
+				fatalf("error writing high-water mark file [%s]: %s", highWaterMarkFile, err)
+			}
+			log.Printf("high-water mark moved to [%s]", started.UTC().Format(time.RFC3339Nano))
+		} else {
+			log.Printf("not every batch was loaded, high-water mark left at [%s]", from.Format(time.RFC3339Nano))
+		}
+	case modeWatch:
+		dl := write.NewDeadLetterWriter(deadLetterFile)
+		watch(w, f, dl)
+	case modeReplay:
+		if sameFile(replayFile, deadLetterFile) {
+			fatalf("replay file [%s] must differ from the dead-letter file being written", replayFile)
+		}
+		dl := write.NewDeadLetterWriter(deadLetterFile)
+		replay(w, dl)
+	default:
+		fatalf("unknown mode [%s]", mode)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
-	defer cancel()
-	defer func(client *mongo.Client, ctx context.Context) {
-		err := client.Disconnect(ctx)
-		if err != nil {
-			fatalf("error disconnecting from client: %s", err)
+	closeAlphaKeyCache()
+}
+
+// load copies the documents in the mongoDB collection matching filter to Elastic Search, returning whether
+// every batch read was fully loaded. An interrupted load exits rather than returning.
+func load(w write.Writer, f format.Formatter, dl write.DeadLetterWriter, filter bson.D) bool {
+	client, disconnect := connectToMongo()
+	defer disconnect()
+
+	var err error
+	last := ""
+	if resume {
+		if last, err = checkpoint.Load(checkpointFile); err != nil {
+			fatalf("error reading checkpoint file [%s]: %s", checkpointFile, err)
 		}
-	}(client, ctx)
+		log.Printf("resuming load after _id [%s]", last)
+	}
+	tracker := checkpoint.NewTracker(checkpointFile, last)
+
+	restoreSettings := func(bool) {}
+	if tuneBulkLoad {
+		restoreSettings = tuneForBulkLoad(
+			eshttp.NewClientWithRetryPolicy(w, adminRequester, retryPolicy),
+			eshttp.NewClientWithRetryPolicy(w, maintenanceRequester, eshttp.NoRetries),
+			esDestIndex)
+	}
 
 	go status()
 	companyProfileCollection := client.Database(mongoDatabase).Collection(mongoCollection)
 	findOptions := options.Find()
 	findOptions.SetBatchSize(int32(mongoSize))
+	// Sorting by _id is what makes the checkpoint meaningful: every _id up to it has been loaded.
+	findOptions.SetSort(bson.D{{Key: "_id", Value: 1}})
 	ctx2, cancel2 := context.WithTimeout(context.Background(), mongoTimeout)
 	defer cancel2()
-	cur, err := companyProfileCollection.Find(ctx2, bson.D{}, findOptions)
+	cur, err := companyProfileCollection.Find(ctx2, append(filter, resumeFilter(last)...), findOptions)
 	if err != nil {
 		fatalf("error reading from collection: %s", err)
 	}
 
 	ctx3, cancel3 := context.WithCancel(context.Background())
 	defer cancel3()
+	handleSignals(cancel3, abortRequests)
 
-	sendCompaniesToES(cur, ctx3, err, w, f)
+	builder := newBulkBuilder()
+	interrupted := sendCompaniesToES(cur, ctx3, err, w, f, dl, tracker, builder)
 
-	time.Sleep(5 * time.Second)
+	if !interrupted {
+		time.Sleep(5 * time.Second)
+	}
 	syncWaitGroup.Wait()
 
+	// The last pages' items are left in a bulk short of the limits; an interrupted load rereads them on resume.
+	if !interrupted {
+		sendBulksToES(eshttp.NewClientWithRetryPolicy(w, esRequester, retryPolicy), w, dl, builder, builder.flush())
+	}
+	restoreSettings(interrupted)
+
 	w.Close()
+	dl.Close()
+
+	close(statusStop)
+	<-statusDone
+
+	if interrupted {
+		log.Printf("INTERRUPTED: %s data loaded into [%s] for alias [%s] up to _id [%s], rerun with -resume to continue",
+			loaderType, esDestIndex, esAlias, tracker.Last())
+		exit(exitInterrupted)
+	}
 
-	log.Println("SUCCESSFULLY LOADED: company data to alpha_search index")
+	log.Printf("SUCCESSFULLY LOADED: %s data to [%s] for alias [%s], checkpoint at _id [%s]", loaderType, esDestIndex, esAlias, tracker.Last())
+	return tracker.Complete()
 }
 
-func sendCompaniesToES(cur *mongo.Cursor, ctx3 context.Context, err error, w write.Writer, f format.Formatter) {
+// connectToMongo returns a client connected to mongoURL, along with a function with which to disconnect it
+func connectToMongo() (*mongo.Client, func()) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongoURL))
+	if err != nil {
+		fatalf("error creating mongoDB session: %s", err)
+	}
+
+	return client, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+		defer cancel()
+		if err := client.Disconnect(ctx); err != nil {
+			fatalf("error disconnecting from client: %s", err)
+		}
+	}
+}
+
+// newRequester returns an eshttp.Requester with which to send requests to Elastic Search, authenticating and
+// verifying them as configured, and gzipping them if -gzip is set. Its requests are aborted once ctx is done,
+// unless ctx is nil.
+func newRequester(ctx context.Context) eshttp.Requester {
+
+	return newRequesterWithConnections(ctx, connections)
+}
+
+// newMaintenanceRequester returns an eshttp.Requester like that of newRequester, but without -http-timeout, for
+// requests such as a force merge which take as long as the index needs
+func newMaintenanceRequester() eshttp.Requester {
+	untimed := connections
+	untimed.RequestTimeout = 0
+	return newRequesterWithConnections(nil, untimed)
+}
+
+// newRequesterWithConnections returns an eshttp.Requester configured as newRequester describes, whose
+// connections are bounded by c
+func newRequesterWithConnections(ctx context.Context, c eshttp.Connections) eshttp.Requester {
+	r, err := eshttp.NewRequesterWithConfig(eshttp.RequesterConfig{
+		Gzip:        gzipRequests,
+		Stats:       &compression,
+		Auth:        esAuth,
+		TLS:         esTLS,
+		Connections: c,
+		Context:     ctx,
+	})
+	if err != nil {
+		fatalf("error configuring requests to elasticsearch: %s", err)
+	}
+	return r
+}
+
+// newAlphaKeyRequester returns an eshttp.Requester with which to send plain requests to the alphakey service.
+// Its requests are aborted once ctx is done.
+func newAlphaKeyRequester(ctx context.Context) eshttp.Requester {
+	r, err := eshttp.NewRequesterWithConfig(eshttp.RequesterConfig{Connections: connections, Context: ctx})
+	if err != nil {
+		fatalf("error configuring requests to the alphakey service: %s", err)
+	}
+	return r
+}
+
+// incrementalSince returns the time after which changes are to be synced, taken from the -since flag or,
+// failing that, the high-water mark recorded by the last clean incremental sync.
+func incrementalSince() time.Time {
+	value := since
+	if value == "" {
+		var err error
+		if value, err = checkpoint.Load(highWaterMarkFile); err != nil {
+			fatalf("error reading high-water mark file [%s]: %s", highWaterMarkFile, err)
+		}
+		if value == "" {
+			fatalf("no -since given and no high-water mark recorded in [%s]", highWaterMarkFile)
+		}
+	}
+
+	from, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		fatalf("error parsing time [%s]: %s", value, err)
+	}
+	return from
+}
+
+// updatedSinceFilter returns a filter selecting only documents updated at or after from.
+func updatedSinceFilter(from time.Time) bson.D {
+	return bson.D{{Key: updatedField, Value: bson.D{{Key: "$gte", Value: from}}}}
+}
+
+// resumeFilter returns a filter selecting only documents after the last checkpointed _id, if any.
+func resumeFilter(last string) bson.D {
+	if last == "" {
+		return bson.D{}
+	}
+	return bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: last}}}}
+}
+
+// sendCompaniesToES reads the cursor a page at a time and hands each page to sendToES, returning true if
+// reading was stopped by ctx3 being cancelled rather than by reaching the end of the cursor.
+func sendCompaniesToES(cur *mongo.Cursor, ctx3 context.Context, err error, w write.Writer, f format.Formatter, dl write.DeadLetterWriter, tracker checkpoint.Tracker, builder *bulkBuilder) bool {
 	for {
 		companies := make([]*datastructures.MongoCompany, mongoSize)
 		itx := 0
@@ -135,22 +452,28 @@ func sendCompaniesToES(cur *mongo.Cursor, ctx3 context.Context, err error, w wri
 			}
 			result := datastructures.MongoCompany{}
 			if err = cur.Decode(&result); err != nil {
-				log.Fatal(err)
+				fatalf("error decoding company: %s", err)
 			}
+			keepRaw(&result, cur.Current)
 			companies[itx] = &result
 		}
 
+		// A partially read page is dropped on interrupt; it lies after the checkpoint so is reread on resume.
+		if ctx3.Err() != nil {
+			return true
+		}
+
 		if err := cur.Err(); err != nil {
 			fatalf("error iterating the collection: %s", err)
 		}
 
 		// No results read from iterator. Nothing more to do.
 		if itx == 0 {
-			break
+			return false
 		}
 
-		// This will block if we've reached our concurrency limit (sem buffer size)
-		sendToES(&companies, itx, w, f)
+		// This will block if we've reached our concurrency limit (see workers)
+		sendToES(ctx3, &companies, itx, w, f, dl, tracker, builder)
 	}
 }
 
@@ -161,73 +484,171 @@ func sendCompaniesToES(cur *mongo.Cursor, ctx3 context.Context, err error, w wri
  otherwise golang will create a copy of the slice on the stack!
 */
 
-func sendToES(companies *[]*datastructures.MongoCompany, length int, w write.Writer, f format.Formatter) {
+func sendToES(ctx context.Context, companies *[]*datastructures.MongoCompany, length int, w write.Writer, f format.Formatter, dl write.DeadLetterWriter, tracker checkpoint.Tracker, builder *bulkBuilder) {
 
-	// Wait on semaphore if we've reached our concurrency limit
+	// Batches are registered in cursor order so that the checkpoint only ever covers contiguous batches.
+	seq := tracker.Add((*companies)[length-1].ID)
+
+	// Wait for a worker if we've reached our concurrency limit, unless we are shutting down, in which
+	// case the batch is never confirmed and will be reread on resume.
+	if !workers.Acquire(ctx) {
+		return
+	}
 	syncWaitGroup.Add(1)
-	semaphore <- 1
 
-	t := transform.NewTransformer(w, f)
-	c := eshttp.NewClient(w)
+	t := newTransformer(w, f)
+	c := eshttp.NewClientWithRetryPolicy(w, esRequester, retryPolicy)
+	ak, fallback := alphaKeyGenerator, alphaKeyFallback
 
 	go func() {
 		defer func() {
-			<-semaphore
+			workers.Release()
 			syncWaitGroup.Done()
 		}()
 
 		countChannel <- length
-		target := length
 
-		var bulk []byte
-		var companyNumbers []byte
+		var items []bulkItem
 
-		err, alphaKeys := getAlphaKeys(t, companies, length, c)
+		// An aborted batch is never confirmed, so is reread on resume.
+		err, alphaKeys := getAlphaKeys(t, companies, length, ak, fallback, w)
+		if err != nil {
+			return
+		}
 
-		bulk, companyNumbers, target =
+		var keyed bool
+		items, _, keyed =
 			transformMongoCompaniesToEsCompanies(
 				length,
 				t,
 				companies,
 				alphaKeys,
-				bulk,
-				companyNumbers,
-				target)
-
-		if submitBulkToES(err, c, bulk, companyNumbers) {
-			return
-		}
-
-		insertChannel <- target
+				items,
+				length)
+
+		// The batch is confirmed once all of its items are sent, whichever bulks they share with other batches.
+		// A batch holding companies without alpha keys is left unconfirmed, to be reread on resume.
+		bulks := builder.add(items, func(ok bool) {
+			if ok && keyed {
+				tracker.Confirm(seq)
+			}
+		})
+		sendBulksToES(c, w, dl, builder, bulks)
 	}()
 }
 
-func submitBulkToES(err error, c eshttp.Client, bulk []byte, companyNumbers []byte) bool {
-	b, err := c.SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex)
-	if err != nil {
-		return true
+// sendBulksToES sends each of bulks to Elastic Search, acknowledging it to builder once it has been sent
+func sendBulksToES(c eshttp.Client, w write.Writer, dl write.DeadLetterWriter, builder *bulkBuilder, bulks []pageBulk) {
+	for _, bulk := range bulks {
+		written, ok := submitBulkToES(c, w, dl, bulk.items)
+		builder.acknowledge(bulk, ok)
+
+		insertChannel <- written
+		if failed := len(bulk.items) - written; failed > 0 {
+			failChannel <- failed
+		}
 	}
+}
 
-	var bulkRes esBulkResponse
-	if err := unmarshal(b, &bulkRes); err != nil {
-		fatalf("error unmarshalling json: [%s] actual response: [%s]", err, b)
+// submitBulksToES sends items to Elastic Search in as many bulk requests as -bulk-max-docs and -bulk-max-bytes
+// require, returning the number of items written and whether every bulk was accounted for.
+func submitBulksToES(c eshttp.Client, w write.Writer, dl write.DeadLetterWriter, items []bulkItem) (int, bool) {
+	written, ok := 0, true
+	for _, bulk := range splitBulk(items, bulkMaxDocs, bulkMaxBytes) {
+		n, bulkOK := submitBulkToES(c, w, dl, bulk)
+		written += n
+		ok = ok && bulkOK
 	}
+	return written, ok
+}
+
+// submitBulkToES sends items to Elastic Search as a single bulk request, resending any rejected for transient
+// reasons such as a full write queue. Any item which cannot be written is recorded in the dead-letter file. It
+// returns the number of items written, and whether every item is accounted for: that is, none were lost to a
+// failed request or to transient rejections which persisted beyond the retry policy.
+func submitBulkToES(c eshttp.Client, w write.Writer, dl write.DeadLetterWriter, items []bulkItem) (int, bool) {
+	written := 0
+
+	for attempt := 1; ; attempt++ {
+		b, err := c.SubmitBulkToES(bulkBody(items), bulkCompanyNumbers(items), esDestURL, esDestIndex)
+		// An aborted batch is never confirmed, so is reread on resume rather than needing replay.
+		if errors.Is(err, context.Canceled) {
+			return written, false
+		}
+		if err != nil {
+			workers.Observe(0, true)
+			for _, item := range items {
+				dl.Write(item.deadLetter(0, err.Error()))
+			}
+			return written, false
+		}
+
+		var bulkRes esBulkResponse
+		if err := unmarshal(b, &bulkRes); err != nil {
+			fatalf("error unmarshalling json: [%s] actual response: [%s]", err, b)
+		}
+
+		if !bulkRes.Errors {
+			workers.Observe(time.Duration(bulkRes.Took)*time.Millisecond, false)
+			return written + len(items), true
+		}
+
+		// Results are matched to items by position, so none of them can be trusted; replay decides afresh.
+		if len(bulkRes.Items) != len(items) {
+			log.Printf("bulk response holds %d items for a request of %d: %s", len(bulkRes.Items), len(items), b)
+			reason := fmt.Sprintf("bulk response held %d items for a request of %d", len(bulkRes.Items), len(items))
+			for _, item := range items {
+				dl.Write(item.deadLetter(0, reason))
+			}
+			return written, false
+		}
 
-	if bulkRes.Errors {
-		for _, r := range bulkRes.Items {
-			if r["create"].Status != 201 {
-				fatalf("error inserting doc: %s", r["create"].Error)
+		var retry []bulkItem
+		var rejections []esBulkItemResponseData
+		for i, r := range bulkRes.Items {
+			res := r.result()
+			switch {
+			case r.succeeded():
+				written++
+			case res.retryable():
+				retry = append(retry, items[i])
+				rejections = append(rejections, res)
+			default:
+				dl.Write(items[i].deadLetter(res.Status, res.Error.String()))
 			}
 		}
+
+		// Transient rejections mean Elastic Search is struggling to keep up with the workers.
+		workers.Observe(time.Duration(bulkRes.Took)*time.Millisecond, len(retry) > 0)
+
+		if len(retry) == 0 {
+			return written, true
+		}
+
+		if attempt >= retryPolicy.MaxAttempts {
+			for i, item := range retry {
+				log.Printf("giving up on doc %s after %d attempt(s)", item.id, attempt)
+				dl.Write(item.deadLetter(rejections[i].Status, rejections[i].Error.String()))
+			}
+			return written, false
+		}
+
+		d := retryPolicy.Delay(attempt)
+		log.Printf("%d of %d docs rejected for transient reasons, resending in %s", len(retry), len(items), d)
+		sleep(d)
+		items = retry
 	}
-	return false
 }
 
+// getAlphaKeys fetches the alpha keys of the companies' names through c, asking fallback for the keys of each
+// name on its own where c gives none. It returns an error only if the request was aborted.
 func getAlphaKeys(
 	t transform.Transformer,
 	companies *[]*datastructures.MongoCompany,
 	length int,
-	c eshttp.Client) (error, []datastructures.AlphaKey) {
+	c alphakey.Generator,
+	fallback alphakey.Generator,
+	w write.Writer) (error, []datastructures.AlphaKey) {
 	companyNames := t.GetCompanyNames(companies, length)
 	compNamesBody, err := marshal(companyNames)
 	if err != nil {
@@ -235,6 +656,9 @@ func getAlphaKeys(
 	}
 
 	keys, err := c.GetAlphaKeys(compNamesBody, alphakeyURL)
+	if errors.Is(err, context.Canceled) {
+		return err, nil
+	}
 	if err != nil {
 		fatalf("error fetching alpha keys: %s", err)
 	}
@@ -243,39 +667,111 @@ func getAlphaKeys(
 	if err := unmarshal(keys, &alphaKeys); err != nil {
 		fatalf("error %v unmarshalling alphakey response for %s", err, compNamesBody)
 	}
+
+	// Keys are matched to names by position alone, so a response of the wrong length cannot be trusted at all.
+	if len(alphaKeys) != len(companyNames) {
+		log.Printf("alphakey response holds %d keys for %d names, fetching each name's keys separately", len(alphaKeys), len(companyNames))
+		alphaKeys = make([]datastructures.AlphaKey, len(companyNames))
+	}
+	for i, name := range companyNames {
+		if !validAlphaKey(name, alphaKeys[i]) {
+			alphaKeys[i] = getAlphaKey(fallback, w, name)
+		}
+	}
 	return err, alphaKeys
 }
 
+// getAlphaKey fetches the keys of a single company name, logging the name to the alpha key errors file and
+// returning empty keys if no valid keys are returned
+func getAlphaKey(c alphakey.Generator, w write.Writer, name datastructures.CompanyName) datastructures.AlphaKey {
+	body, err := marshal([]datastructures.CompanyName{name})
+	if err != nil {
+		fatalf("error marshal to json: %s", err)
+	}
+
+	var alphaKeys []datastructures.AlphaKey
+	keys, err := c.GetAlphaKeys(body, alphakeyURL)
+	if err == nil {
+		err = unmarshal(keys, &alphaKeys)
+	}
+	if err != nil || len(alphaKeys) != 1 || !validAlphaKey(name, alphaKeys[0]) {
+		log.Printf("no valid alpha keys for [%s]: %s", name.Name, keys)
+		w.LogAlphaKeyErrors(name.Name)
+		return datastructures.AlphaKey{}
+	}
+	return alphaKeys[0]
+}
+
+// validAlphaKey reports whether key is fit to be indexed with the company named. The nameless spacers standing
+// in for companies which will be skipped need no key.
+func validAlphaKey(name datastructures.CompanyName, key datastructures.AlphaKey) bool {
+	return name.Name == "" || (key.SameAsAlphaKey != "" && key.OrderedAlphaKey != "")
+}
+
+// transformMongoCompaniesToEsCompanies appends the bulk items of the companies which can be indexed to items,
+// returning them with target less the companies skipped or failed, and whether every company had alpha keys
 func transformMongoCompaniesToEsCompanies(
 	length int,
 	t transform.Transformer,
 	companies *[]*datastructures.MongoCompany,
 	alphaKeys []datastructures.AlphaKey,
-	bulk []byte,
-	companyNumbers []byte,
-	target int) ([]byte, []byte, int) {
+	items []bulkItem,
+	target int) ([]bulkItem, int, bool) {
+	keyed := true
 	i := 0
+	// The keys of the companies' previous names follow those of their names, in the same order as the companies.
+	previous := length
 	for i < length {
-		company := t.TransformMongoCompanyToEsCompany((*companies)[i], &alphaKeys[i])
+		var previousAlphaKeys []datastructures.AlphaKey
+		n := previousNameCount(t, (*companies)[i])
+		if n > 0 && previous+n <= len(alphaKeys) {
+			previousAlphaKeys = alphaKeys[previous : previous+n]
+		}
+		previous += n
 
-		if company != nil {
+		company := t.TransformMongoCompanyToEsCompany((*companies)[i], &alphaKeys[i], previousAlphaKeys)
+
+		switch {
+		case company == nil:
+			skipChannel <- 1
+			target--
+		case alphaKeys[i].SameAsAlphaKey == "" || alphaKeys[i].OrderedAlphaKey == "":
+			// Its name has already been logged to the alpha key errors file; indexed without keys it could not be
+			// found, and dead-lettered it would be replayed without them, so the company is left to be reread.
+			failChannel <- 1
+			target--
+			keyed = false
+		default:
 			b, err := marshal(company)
 			if err != nil {
 				fatalf("error marshal to json: %s", err)
 			}
 
-			bulk = append(bulk, []byte("{ \"create\": { \"_id\": \""+company.ID+"\" } }\n")...)
-			bulk = append(bulk, b...)
-			bulk = append(bulk, []byte("\n")...)
-			companyNumbers = append(companyNumbers, []byte("\n"+company.ID+"")...)
-		} else {
-			skipChannel <- 1
-			target--
+			items = append(items, newBulkItem(bulkAction, company.ID, b))
 		}
 
 		i++
 	}
-	return bulk, companyNumbers, target
+	return items, target, keyed
+}
+
+// previousNameCount returns the number of previous names of company whose alpha keys are fetched along with its name
+func previousNameCount(t transform.Transformer, company *datastructures.MongoCompany) int {
+	if counter, ok := t.(transform.PreviousNameCounter); ok {
+		return counter.PreviousNameCount(company)
+	}
+	if company == nil || company.Data == nil {
+		return 0
+	}
+	return len(company.Data.PreviousCompanyNames)
+}
+
+// applyModeDefaults gives incremental syncs their own checkpoint file, unless -checkpoint-file is given, as their
+// checkpoints are taken under a different filter from those of full loads
+func applyModeDefaults(given map[string]bool) {
+	if mode == modeIncremental && !given["checkpoint-file"] {
+		checkpointFile = incrementalCheckpointFile
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -288,9 +784,11 @@ func status() {
 		reqTotal    = 0
 		insTotal    = 0
 		skipTotal   = 0
+		failTotal   = 0
 	)
 
 	t := time.NewTicker(time.Second)
+	defer t.Stop()
 
 	for {
 		select {
@@ -303,13 +801,28 @@ func status() {
 		case n := <-insertChannel:
 			insCounter += n
 			insTotal += n
+		case n := <-failChannel:
+			failTotal += n
 		case <-t.C:
-			log.Printf("Read: %6d  Written: %6d  Skipped: %6d  |  rps: %6d  ips: %6d  sps: %6d", reqTotal, insTotal, skipTotal, rpsCounter, insCounter, skipCounter)
+			log.Printf("Read: %6d  Written: %6d  Skipped: %6d  Failed: %6d  |  rps: %6d  ips: %6d  sps: %6d  workers: %2d%s%s", reqTotal, insTotal, skipTotal, failTotal, rpsCounter, insCounter, skipCounter, workers.Workers(), compressionStatus(), alphaKeyCacheStatus())
 			rpsCounter = 0
 			insCounter = 0
 			skipCounter = 0
+		case <-statusStop:
+			log.Printf("TOTAL Read: %6d  Written: %6d  Skipped: %6d  Failed: %6d%s%s", reqTotal, insTotal, skipTotal, failTotal, compressionStatus(), alphaKeyCacheStatus())
+			totals = statusTotals{read: reqTotal, written: insTotal, skipped: skipTotal, failed: failTotal}
+			close(statusDone)
+			return
 		}
 	}
 }
 
+// compressionStatus returns the compression ratio achieved so far for the status output, if compressing
+func compressionStatus() string {
+	if !gzipRequests {
+		return ""
+	}
+	return fmt.Sprintf("  gzip: %4.1fx", compression.Ratio())
+}
+
 // ------------------------------------------------------------------------------
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/companieshouse/elasticsearch-data-loader/checkpoint"
 	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
 	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
 	"github.com/companieshouse/elasticsearch-data-loader/transform"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestUnitGetAlphaKeys(t *testing.T) {
@@ -33,13 +42,32 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 			OrderedAlphaKey: "blah",
 		}
 
-		err, alphaKeys := getAlphaKeys(transformer, &companies, 0, client)
+		err, alphaKeys := getAlphaKeys(transformer, &companies, 0, client, client, write.NewMockWriter(ctrl))
 		So(err, ShouldBeNil)
 		So(alphaKeys, ShouldNotBeNil)
 		So(len(alphaKeys), ShouldEqual, 1)
 		So(alphaKeys[0], ShouldResemble, expectedAlphaKey)
 	})
 
+	Convey("Should return the error of an aborted request rather than exit", t, func() {
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		client := eshttp.NewMockClient(ctrl)
+		companies := []*datastructures.MongoCompany{{}}
+
+		companyNames := []datastructures.CompanyName{{Name: "Blah Co"}}
+		companyNamesBody, _ := json.Marshal(companyNames)
+
+		transformer.EXPECT().GetCompanyNames(&companies, 0).Return(companyNames)
+		client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).
+			Return(nil, fmt.Errorf("Post: %w", context.Canceled))
+
+		err, alphaKeys := getAlphaKeys(transformer, &companies, 0, client, client, write.NewMockWriter(ctrl))
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(alphaKeys, ShouldBeNil)
+	})
+
 	Convey("Should handle failure to marshal company names by exiting program", t, func() {
 
 		restoreJsonMarshal := stubJsonMarshal()
@@ -59,7 +87,7 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 		transformer.EXPECT().GetCompanyNames(&companies, 0).Times(1)
 		client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).Times(0)
 
-		So(func() { getAlphaKeys(transformer, &companies, 0, client) },
+		So(func() { getAlphaKeys(transformer, &companies, 0, client, client, write.NewMockWriter(ctrl)) },
 			ShouldPanicWith,
 			"error marshal to json: json: unsupported value: Test generated error")
 
@@ -86,7 +114,7 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 		client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).Return(
 			nil, errors.New("Test generated error"))
 
-		So(func() { getAlphaKeys(transformer, &companies, 0, client) },
+		So(func() { getAlphaKeys(transformer, &companies, 0, client, client, write.NewMockWriter(ctrl)) },
 			ShouldPanicWith,
 			"error fetching alpha keys: Test generated error")
 		So(unmarshalCalled, ShouldBeFalse)
@@ -113,7 +141,7 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 		client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).Return(
 			[]byte("[{\"sameAsAlphaKey\":\"true\", \"orderedAlphaKey\":\"blah\"}]"), nil)
 
-		So(func() { getAlphaKeys(transformer, &companies, 0, client) },
+		So(func() { getAlphaKeys(transformer, &companies, 0, client, client, write.NewMockWriter(ctrl)) },
 			ShouldPanicWith,
 			"error json: cannot unmarshal Test generated error into Go struct "+
 				"field struct.field of type string unmarshalling alphakey response for"+
@@ -121,6 +149,101 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 
 	})
 
+	Convey("Should fetch each name's keys separately from the fallback when the response holds too few keys", t, func() {
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		client := eshttp.NewMockClient(ctrl)
+		fallback := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		companies := []*datastructures.MongoCompany{{}, {}, {}}
+
+		companyNames := []datastructures.CompanyName{{Name: "ACME LTD"}, {}, {Name: "WIDGET LTD"}}
+		companyNamesBody, _ := json.Marshal(companyNames)
+
+		transformer.EXPECT().GetCompanyNames(&companies, 3).Return(companyNames)
+		gomock.InOrder(
+			client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).
+				Return([]byte(`[{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"}]`), nil),
+			fallback.EXPECT().GetAlphaKeys([]byte(`[{"name":"ACME LTD"}]`), alphakeyURL).
+				Return([]byte(`[{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"}]`), nil),
+			fallback.EXPECT().GetAlphaKeys([]byte(`[{"name":"WIDGET LTD"}]`), alphakeyURL).
+				Return([]byte(`[{"sameAsAlphaKey":"WIDGET","orderedAlphaKey":"WIDGETLTD"}]`), nil),
+		)
+
+		_, alphaKeys := getAlphaKeys(transformer, &companies, 3, client, fallback, writer)
+
+		So(alphaKeys, ShouldResemble, []datastructures.AlphaKey{
+			{SameAsAlphaKey: "ACME", OrderedAlphaKey: "ACMELTD"},
+			{},
+			{SameAsAlphaKey: "WIDGET", OrderedAlphaKey: "WIDGETLTD"},
+		})
+	})
+
+	Convey("Should refetch just the names given empty keys, logging those still without keys", t, func() {
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		companies := []*datastructures.MongoCompany{{}, {}}
+
+		companyNames := []datastructures.CompanyName{{Name: "ACME LTD"}, {Name: "!!!"}}
+		companyNamesBody, _ := json.Marshal(companyNames)
+
+		transformer.EXPECT().GetCompanyNames(&companies, 2).Return(companyNames)
+		gomock.InOrder(
+			client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).
+				Return([]byte(`[{"sameAsAlphaKey":"ACME","orderedAlphaKey":"ACMELTD"},{"sameAsAlphaKey":"","orderedAlphaKey":""}]`), nil),
+			client.EXPECT().GetAlphaKeys([]byte(`[{"name":"!!!"}]`), alphakeyURL).
+				Return([]byte(`[{"sameAsAlphaKey":"","orderedAlphaKey":""}]`), nil),
+		)
+		writer.EXPECT().LogAlphaKeyErrors("!!!").Times(1)
+
+		_, alphaKeys := getAlphaKeys(transformer, &companies, 2, client, client, writer)
+
+		So(alphaKeys, ShouldResemble, []datastructures.AlphaKey{
+			{SameAsAlphaKey: "ACME", OrderedAlphaKey: "ACMELTD"},
+			{},
+		})
+	})
+}
+
+func TestUnitSendToES(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "companybindex")
+	defer os.RemoveAll(dir)
+
+	realGenerator, realFallback := alphaKeyGenerator, alphaKeyFallback
+	realCountChannel, realFailChannel := countChannel, failChannel
+	defer func() {
+		alphaKeyGenerator, alphaKeyFallback = realGenerator, realFallback
+		countChannel, failChannel = realCountChannel, realFailChannel
+	}()
+
+	Convey("Should leave a batch holding a company without alpha keys unconfirmed, to be reread on resume", t, func() {
+
+		countChannel, failChannel = make(chan int, 1), make(chan int, 1)
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		alphaKeyGenerator, alphaKeyFallback = client, client
+
+		companies := []*datastructures.MongoCompany{{ID: "00000001", Data: &datastructures.MongoData{CompanyName: "!!!"}}}
+		client.EXPECT().GetAlphaKeys([]byte(`[{"name":"!!!"}]`), alphakeyURL).
+			Return([]byte(`[{"sameAsAlphaKey":"","orderedAlphaKey":""}]`), nil).Times(2)
+		writer.EXPECT().LogAlphaKeyErrors("!!!").Times(1)
+
+		tracker := checkpoint.NewTracker(filepath.Join(dir, "checkpoint.txt"), "")
+		sendToES(context.Background(), &companies, 1, writer, format.NewFormatter(), write.NewMockDeadLetterWriter(ctrl), tracker, newBulkBuilder())
+		syncWaitGroup.Wait()
+
+		So(<-countChannel, ShouldEqual, 1)
+		So(<-failChannel, ShouldEqual, 1)
+		So(tracker.Last(), ShouldBeEmpty)
+		So(tracker.Complete(), ShouldBeFalse)
+	})
 }
 
 func TestUnitTransformMongoCompaniesToEsCompanies(t *testing.T) {
@@ -144,7 +267,8 @@ func TestUnitTransformMongoCompaniesToEsCompanies(t *testing.T) {
 			&datastructures.AlphaKey{
 				SameAsAlphaKey:  "true",
 				OrderedAlphaKey: "blah",
-			}).Return(&datastructures.EsCompany{
+			},
+			nil).Return(&datastructures.EsCompany{
 			ID:                    "",
 			CompanyType:           "",
 			Items:                 datastructures.EsItem{},
@@ -153,21 +277,21 @@ func TestUnitTransformMongoCompaniesToEsCompanies(t *testing.T) {
 			OrderedAlphaKeyWithID: "",
 		})
 
-		bulk, companyNumbers, target :=
+		items, target, _ :=
 			transformMongoCompaniesToEsCompanies(
 				1,
 				transformer,
 				&companies,
 				keys,
-				[]byte("bulk"),
-				[]byte("companyNumbers"),
+				nil,
 				1)
-		So(string(bulk), ShouldContainSubstring,
-			`bulk{ "create": { "_id": "" } }
+		So(string(bulkBody(items)), ShouldContainSubstring,
+			`{ "create": { "_id": "" } }
 {"ID":"","company_type":"","items":{"company_number":"","corporate_name":"","corporate_name_start":`+
 				`"","record_type":"","alpha_key":"","ordered_alpha_key":""},`+
-				`"kind":"","links":null,"ordered_alpha_key_with_id":""}`)
-		So(string(companyNumbers), ShouldEqual, `companyNumbers
+				`"kind":"","links":null,"ordered_alpha_key_with_id":"","alpha_key_with_id":"",`+
+				`"corporate_stripped":"","corporate_stripped_len":0,"corporate_with_type":"","active_count":0}`)
+		So(string(bulkCompanyNumbers(items)), ShouldEqual, `
 `)
 		So(target, ShouldEqual, 1)
 	})
@@ -197,7 +321,8 @@ func TestUnitTransformMongoCompaniesToEsCompanies(t *testing.T) {
 			&datastructures.AlphaKey{
 				SameAsAlphaKey:  "true",
 				OrderedAlphaKey: "blah",
-			}).Return(&datastructures.EsCompany{
+			},
+			nil).Return(&datastructures.EsCompany{
 			ID:                    "",
 			CompanyType:           "",
 			Items:                 datastructures.EsItem{},
@@ -212,8 +337,7 @@ func TestUnitTransformMongoCompaniesToEsCompanies(t *testing.T) {
 				transformer,
 				&companies,
 				keys,
-				[]byte("bulk"),
-				[]byte("companyNumbers"),
+				nil,
 				1)
 		},
 			ShouldPanicWith,
@@ -243,23 +367,104 @@ func TestUnitTransformMongoCompaniesToEsCompanies(t *testing.T) {
 			&datastructures.AlphaKey{
 				SameAsAlphaKey:  "true",
 				OrderedAlphaKey: "blah",
-			}).Return(nil)
+			},
+			nil).Return(nil)
 
 		go transformMongoCompaniesToEsCompanies(
 			1,
 			transformer,
 			&companies,
 			keys,
-			[]byte("bulk"),
-			[]byte("companyNumbers"),
+			nil,
 			1)
 		increment := <-skipChannel
 		So(increment, ShouldEqual, 1)
 	})
+
+	Convey("Should pass each company the alpha keys of its own previous names", t, func() {
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		one := &datastructures.MongoCompany{ID: "One", Data: &datastructures.MongoData{
+			PreviousCompanyNames: []datastructures.MongoPreviousName{{Name: "A"}, {Name: "B"}},
+		}}
+		two := &datastructures.MongoCompany{ID: "Two", Data: &datastructures.MongoData{}}
+		three := &datastructures.MongoCompany{ID: "Three", Data: &datastructures.MongoData{
+			PreviousCompanyNames: []datastructures.MongoPreviousName{{Name: "C"}},
+		}}
+		companies := []*datastructures.MongoCompany{one, two, three}
+		keys := []datastructures.AlphaKey{
+			{SameAsAlphaKey: "ONE", OrderedAlphaKey: "ONE"}, {SameAsAlphaKey: "TWO", OrderedAlphaKey: "TWO"},
+			{SameAsAlphaKey: "THREE", OrderedAlphaKey: "THREE"},
+			{SameAsAlphaKey: "A"}, {SameAsAlphaKey: "B"}, {SameAsAlphaKey: "C"},
+		}
+
+		gomock.InOrder(
+			transformer.EXPECT().TransformMongoCompanyToEsCompany(one, &keys[0], keys[3:5]).
+				Return(&datastructures.EsCompany{ID: "One"}),
+			transformer.EXPECT().TransformMongoCompanyToEsCompany(two, &keys[1], nil).
+				Return(&datastructures.EsCompany{ID: "Two"}),
+			transformer.EXPECT().TransformMongoCompanyToEsCompany(three, &keys[2], keys[5:6]).
+				Return(&datastructures.EsCompany{ID: "Three"}),
+		)
+
+		items, target, keyed := transformMongoCompaniesToEsCompanies(3, transformer, &companies, keys, nil, 3)
+
+		So(items, ShouldHaveLength, 3)
+		So(target, ShouldEqual, 3)
+		So(keyed, ShouldBeTrue)
+	})
+
+	Convey("Should count a company still without alpha keys as failed, neither indexing it nor reporting the batch keyed", t, func() {
+
+		realFailChannel := failChannel
+		failChannel = make(chan int, 1)
+		defer func() { failChannel = realFailChannel }()
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		companies := []*datastructures.MongoCompany{{ID: "00000001"}, {ID: "00000002"}}
+		keys := []datastructures.AlphaKey{{}, {SameAsAlphaKey: "ACME", OrderedAlphaKey: "ACMELTD"}}
+
+		gomock.InOrder(
+			transformer.EXPECT().TransformMongoCompanyToEsCompany(companies[0], &keys[0], nil).
+				Return(&datastructures.EsCompany{ID: "00000001"}),
+			transformer.EXPECT().TransformMongoCompanyToEsCompany(companies[1], &keys[1], nil).
+				Return(&datastructures.EsCompany{ID: "00000002"}),
+		)
+
+		items, target, keyed := transformMongoCompaniesToEsCompanies(2, transformer, &companies, keys, nil, 2)
+
+		So(<-failChannel, ShouldEqual, 1)
+		So(items, ShouldHaveLength, 1)
+		So(items[0].id, ShouldEqual, "00000002")
+		So(target, ShouldEqual, 1)
+		So(keyed, ShouldBeFalse)
+	})
 }
 
 func TestUnitSubmitBulkToES(t *testing.T) {
 
+	items := []bulkItem{newBulkItem("create", "00000001", []byte("{}"))}
+	bulk := bulkBody(items)
+	companyNumbers := bulkCompanyNumbers(items)
+
+	timestamp := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	realNow := now
+	now = func() time.Time { return timestamp }
+	defer func() { now = realNow }()
+
+	deadLetter := func(id string, status int, reason string) datastructures.DeadLetter {
+		return datastructures.DeadLetter{
+			ID:        id,
+			Action:    json.RawMessage(`{ "create": { "_id": "` + id + `" } }`),
+			Document:  json.RawMessage(`{}`),
+			Reason:    reason,
+			Status:    status,
+			Timestamp: timestamp,
+		}
+	}
+
 	Convey("Should report bulk submission success", t, func() {
 
 		unmarshalCalled := false
@@ -268,24 +473,31 @@ func TestUnitSubmitBulkToES(t *testing.T) {
 
 		ctrl := gomock.NewController(t)
 		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
 
-		client.EXPECT().SubmitBulkToES([]byte("bulk"), []byte("companyNumbers"), esDestURL, esDestIndex).
+		client.EXPECT().SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex).
 			Return([]byte("bulk"), nil)
 
-		submissionFailed := submitBulkToES(nil, client, []byte("bulk"), []byte("companyNumbers"))
-		So(submissionFailed, ShouldEqual, false)
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 1)
+		So(ok, ShouldBeTrue)
 	})
 
 	Convey("Should report bulk submission failure", t, func() {
 
 		ctrl := gomock.NewController(t)
 		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
 
-		client.EXPECT().SubmitBulkToES([]byte("bulk"), []byte("companyNumbers"), esDestURL, esDestIndex).
+		client.EXPECT().SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex).
 			Return([]byte("bulk"), errors.New("Test generated error"))
+		deadLetters.EXPECT().Write(deadLetter("00000001", 0, "Test generated error")).Times(1)
 
-		submissionFailed := submitBulkToES(nil, client, []byte("bulk"), []byte("companyNumbers"))
-		So(submissionFailed, ShouldEqual, true)
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 0)
+		So(ok, ShouldBeFalse)
 	})
 
 	Convey("Should handle failure to unmarshal bulk response by exiting program", t, func() {
@@ -298,12 +510,14 @@ func TestUnitSubmitBulkToES(t *testing.T) {
 
 		ctrl := gomock.NewController(t)
 		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
 
-		client.EXPECT().SubmitBulkToES([]byte("bulk"), []byte("companyNumbers"), esDestURL, esDestIndex).
+		client.EXPECT().SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex).
 			Return([]byte("bulk"), nil)
 
 		So(func() {
-			submitBulkToES(nil, client, []byte("bulk"), []byte("companyNumbers"))
+			submitBulkToES(client, writer, deadLetters, items)
 		},
 			ShouldPanicWith,
 			"error unmarshalling json: [json: cannot unmarshal Test generated error into Go "+
@@ -311,26 +525,427 @@ func TestUnitSubmitBulkToES(t *testing.T) {
 
 	})
 
-	Convey("Should handle failure to create elasticsearch document by exiting program", t, func() {
+	Convey("Should log a permanently rejected document to the dead-letter file without exiting", t, func() {
 
 		restoreJsonUnmarshal := stubJsonUnmarshalWithEsDocumentCreationResponseError()
 		defer restoreJsonUnmarshal()
 
-		restoreLogFatalf := stubLogFatalf()
-		defer restoreLogFatalf()
-
 		ctrl := gomock.NewController(t)
 		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
 
-		client.EXPECT().SubmitBulkToES([]byte("bulk"), []byte("companyNumbers"), esDestURL, esDestIndex).
+		client.EXPECT().SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex).
 			Return([]byte("bulk"), nil)
+		deadLetters.EXPECT().Write(deadLetter("00000001", 400, "mapper_parsing_exception: Test generated error")).Times(1)
 
-		So(func() {
-			submitBulkToES(nil, client, []byte("bulk"), []byte("companyNumbers"))
-		},
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 0)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should resend only the documents rejected for transient reasons", t, func() {
+
+		restoreSleep := stubSleep()
+		defer restoreSleep()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		items := []bulkItem{
+			newBulkItem("create", "00000001", []byte("{}")),
+			newBulkItem("create", "00000002", []byte("{}")),
+			newBulkItem("create", "00000003", []byte("{}")),
+		}
+		rejected := items[1:2]
+
+		gomock.InOrder(
+			client.EXPECT().SubmitBulkToES(bulkBody(items), bulkCompanyNumbers(items), esDestURL, esDestIndex).
+				Return([]byte(`{"errors":true,"items":[`+
+					`{"create":{"_id":"00000001","status":201}},`+
+					`{"create":{"_id":"00000002","status":429,"error":{"type":"es_rejected_execution_exception"}}},`+
+					`{"create":{"_id":"00000003","status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`), nil),
+			client.EXPECT().SubmitBulkToES(bulkBody(rejected), bulkCompanyNumbers(rejected), esDestURL, esDestIndex).
+				Return([]byte(`{"errors":false,"items":[{"create":{"_id":"00000002","status":201}}]}`), nil),
+		)
+		deadLetters.EXPECT().Write(deadLetter("00000003", 400, "mapper_parsing_exception: bad")).Times(1)
+
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 2)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should count the delete of a document which is already gone as written", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		items := []bulkItem{
+			newDeleteBulkItem("00000001"),
+			newBulkItem("create", "00000002", []byte("{}")),
+		}
+
+		client.EXPECT().SubmitBulkToES(bulkBody(items), bulkCompanyNumbers(items), esDestURL, esDestIndex).
+			Return([]byte(`{"errors":true,"items":[`+
+				`{"delete":{"_id":"00000001","status":404,"result":"not_found"}},`+
+				`{"create":{"_id":"00000002","status":404,"error":{"type":"index_not_found_exception","reason":"gone"}}}]}`), nil)
+		deadLetters.EXPECT().Write(deadLetter("00000002", 404, "index_not_found_exception: gone")).Times(1)
+
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 1)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should count the create of a document which already exists as written, as on resuming a load", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		items := []bulkItem{
+			newBulkItem("create", "00000001", []byte("{}")),
+			newBulkItem("create", "00000002", []byte("{}")),
+		}
+
+		client.EXPECT().SubmitBulkToES(bulkBody(items), bulkCompanyNumbers(items), esDestURL, esDestIndex).
+			Return([]byte(`{"errors":true,"items":[`+
+				`{"create":{"_id":"00000001","status":409,"error":{"type":"version_conflict_engine_exception","reason":"document already exists"}}},`+
+				`{"create":{"_id":"00000002","status":201}}]}`), nil)
+
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 2)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should count a replayed create which had landed before it was dead-lettered as written", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		// The bulk timed out after Elasticsearch had applied it, so every document was dead-lettered.
+		items := []bulkItem{deadLetterBulkItem(newBulkItem("create", "00000001", []byte("{}")).deadLetter(0, "timeout"))}
+
+		client.EXPECT().SubmitBulkToES(bulkBody(items), bulkCompanyNumbers(items), esDestURL, esDestIndex).
+			Return([]byte(`{"errors":true,"items":[`+
+				`{"create":{"_id":"00000001","status":409,"error":{"type":"version_conflict_engine_exception"}}}]}`), nil)
+
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 1)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should dead-letter every document when the response cannot be matched to the request", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		items := []bulkItem{
+			newBulkItem("create", "00000001", []byte("{}")),
+			newBulkItem("create", "00000002", []byte("{}")),
+		}
+
+		client.EXPECT().SubmitBulkToES(bulkBody(items), bulkCompanyNumbers(items), esDestURL, esDestIndex).
+			Return([]byte(`{"errors":true,"items":[{"create":{"_id":"00000001","status":400}}]}`), nil)
+		deadLetters.EXPECT().Write(deadLetter("00000001", 0, "bulk response held 1 items for a request of 2")).Times(1)
+		deadLetters.EXPECT().Write(deadLetter("00000002", 0, "bulk response held 1 items for a request of 2")).Times(1)
+
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 0)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Should report failure when transient rejections outlast the retry policy", t, func() {
+
+		restoreSleep := stubSleep()
+		defer restoreSleep()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		client.EXPECT().SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex).
+			Return([]byte(`{"errors":true,"items":[{"create":{"_id":"00000001","status":503}}]}`), nil).
+			Times(retryPolicy.MaxAttempts)
+		deadLetters.EXPECT().Write(deadLetter("00000001", 503, "")).Times(1)
+
+		written, ok := submitBulkToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 0)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestUnitDeadLetterBulkItem(t *testing.T) {
+
+	Convey("Should rebuild the bulk item a dead letter was recorded from", t, func() {
+
+		item := newBulkItem("create", "00006400", []byte(`{"ID":"00006400"}`))
+
+		So(deadLetterBulkItem(item.deadLetter(400, "reason")), ShouldResemble, item)
+	})
+
+	Convey("Should rebuild a delete, which has no document, from its dead letter", t, func() {
+
+		item := newDeleteBulkItem("00006400")
+
+		So(deadLetterBulkItem(item.deadLetter(503, "reason")), ShouldResemble, item)
+	})
+}
+
+func TestUnitSplitBulk(t *testing.T) {
+
+	// Each of these items adds 47 bytes to a bulk body: a 36 byte action line and a 10 byte document plus newline.
+	items := []bulkItem{
+		newBulkItem("create", "00000001", []byte(`{"n":"01"}`)),
+		newBulkItem("create", "00000002", []byte(`{"n":"02"}`)),
+		newBulkItem("create", "00000003", []byte(`{"n":"03"}`)),
+	}
+
+	Convey("Should flush a bulk once it holds the maximum number of documents", t, func() {
+
+		So(splitBulk(items, 2, 0), ShouldResemble, [][]bulkItem{items[:2], items[2:]})
+	})
+
+	Convey("Should flush a bulk before it exceeds the byte budget", t, func() {
+
+		So(items[0].size(), ShouldEqual, len(bulkBody(items[:1])))
+		So(splitBulk(items, 0, 100), ShouldResemble, [][]bulkItem{items[:2], items[2:]})
+		So(splitBulk(items, 0, 93), ShouldResemble, [][]bulkItem{items[:1], items[1:2], items[2:]})
+	})
+
+	Convey("Should give an item larger than the byte budget a bulk of its own", t, func() {
+
+		So(splitBulk(items, 0, 10), ShouldResemble, [][]bulkItem{items[:1], items[1:2], items[2:]})
+	})
+
+	Convey("Should keep every item in one bulk when there are no limits", t, func() {
+
+		So(splitBulk(items, 0, 0), ShouldResemble, [][]bulkItem{items})
+		So(splitBulk(nil, 2, 100), ShouldBeEmpty)
+	})
+}
+
+func TestUnitBulkBuilder(t *testing.T) {
+
+	realBulkMaxDocs, realBulkMaxBytes := bulkMaxDocs, bulkMaxBytes
+	defer func() { bulkMaxDocs, bulkMaxBytes = realBulkMaxDocs, realBulkMaxBytes }()
+
+	items := []bulkItem{
+		newBulkItem("create", "00000001", []byte("{}")),
+		newBulkItem("create", "00000002", []byte("{}")),
+		newBulkItem("create", "00000003", []byte("{}")),
+	}
+
+	Convey("Should fill bulks from more than one page", t, func() {
+
+		bulkMaxDocs, bulkMaxBytes = 2, 0
+		builder := newBulkBuilder()
+
+		So(builder.add(items[:1], func(bool) {}), ShouldBeEmpty)
+		bulks := builder.add(items[1:], func(bool) {})
+		So(bulks, ShouldHaveLength, 1)
+		So(bulks[0].items, ShouldResemble, items[:2])
+
+		bulks = builder.flush()
+		So(bulks, ShouldHaveLength, 1)
+		So(bulks[0].items, ShouldResemble, items[2:])
+		So(builder.flush(), ShouldBeEmpty)
+	})
+
+	Convey("Should report a page done once every one of its items is acknowledged", t, func() {
+
+		bulkMaxDocs, bulkMaxBytes = 2, 0
+		builder := newBulkBuilder()
+
+		var first, second []bool
+		builder.add(items[:1], func(ok bool) { first = append(first, ok) })
+		full := builder.add(items[1:], func(ok bool) { second = append(second, ok) })
+		rest := builder.flush()
+
+		builder.acknowledge(full[0], true)
+		So(first, ShouldResemble, []bool{true})
+		So(second, ShouldBeEmpty)
+
+		builder.acknowledge(rest[0], false)
+		So(first, ShouldResemble, []bool{true})
+		So(second, ShouldResemble, []bool{false})
+	})
+
+	Convey("Should report a page without items done at once", t, func() {
+
+		done := false
+		So(newBulkBuilder().add(nil, func(ok bool) { done = ok }), ShouldBeEmpty)
+		So(done, ShouldBeTrue)
+	})
+}
+
+func TestUnitSubmitBulksToES(t *testing.T) {
+
+	realBulkMaxDocs, realBulkMaxBytes := bulkMaxDocs, bulkMaxBytes
+	defer func() { bulkMaxDocs, bulkMaxBytes = realBulkMaxDocs, realBulkMaxBytes }()
+
+	items := []bulkItem{
+		newBulkItem("create", "00000001", []byte("{}")),
+		newBulkItem("create", "00000002", []byte("{}")),
+		newBulkItem("create", "00000003", []byte("{}")),
+	}
+
+	Convey("Should send the items in as many bulks as the limits require", t, func() {
+
+		bulkMaxDocs, bulkMaxBytes = 2, 0
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+		writer := write.NewMockWriter(ctrl)
+		deadLetters := write.NewMockDeadLetterWriter(ctrl)
+
+		gomock.InOrder(
+			client.EXPECT().SubmitBulkToES(bulkBody(items[:2]), bulkCompanyNumbers(items[:2]), esDestURL, esDestIndex).
+				Return([]byte(`{"errors":false}`), nil),
+			client.EXPECT().SubmitBulkToES(bulkBody(items[2:]), bulkCompanyNumbers(items[2:]), esDestURL, esDestIndex).
+				Return(nil, errors.New("connection refused")),
+		)
+		deadLetters.EXPECT().Write(gomock.Any()).Times(1)
+
+		written, ok := submitBulksToES(client, writer, deadLetters, items)
+		So(written, ShouldEqual, 2)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestUnitResumeFilter(t *testing.T) {
+
+	Convey("Should select every document when there is no checkpoint", t, func() {
+
+		So(resumeFilter(""), ShouldResemble, bson.D{})
+	})
+
+	Convey("Should select documents after the checkpointed _id", t, func() {
+
+		So(resumeFilter("00006400"), ShouldResemble,
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: "00006400"}}}})
+	})
+}
+
+func TestUnitApplyModeDefaults(t *testing.T) {
+
+	realMode, realCheckpointFile := mode, checkpointFile
+	defer func() { mode, checkpointFile = realMode, realCheckpointFile }()
+
+	Convey("Should give incremental syncs their own checkpoint file", t, func() {
+
+		mode, checkpointFile = modeIncremental, "checkpoint.txt"
+		applyModeDefaults(map[string]bool{})
+
+		So(checkpointFile, ShouldEqual, incrementalCheckpointFile)
+	})
+
+	Convey("Should keep the checkpoint file given on the command line", t, func() {
+
+		mode, checkpointFile = modeIncremental, "mine.txt"
+		applyModeDefaults(map[string]bool{"checkpoint-file": true})
+
+		So(checkpointFile, ShouldEqual, "mine.txt")
+	})
+
+	Convey("Should leave the checkpoint file of full loads alone", t, func() {
+
+		mode, checkpointFile = modeLoad, "checkpoint.txt"
+		applyModeDefaults(map[string]bool{})
+
+		So(checkpointFile, ShouldEqual, "checkpoint.txt")
+	})
+}
+
+func TestUnitIncrementalSince(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "companybindex")
+	defer os.RemoveAll(dir)
+
+	realSince, realHighWaterMarkFile := since, highWaterMarkFile
+	defer func() { since, highWaterMarkFile = realSince, realHighWaterMarkFile }()
+
+	Convey("Should use the -since flag when given", t, func() {
+
+		since = "2026-10-17T00:00:00Z"
+		highWaterMarkFile = filepath.Join(dir, "missing.txt")
+
+		So(incrementalSince(), ShouldEqual, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC))
+	})
+
+	Convey("Should fall back to the stored high-water mark", t, func() {
+
+		since = ""
+		highWaterMarkFile = filepath.Join(dir, "highWaterMark.txt")
+		_ = ioutil.WriteFile(highWaterMarkFile, []byte("2026-10-16T12:30:00.5Z\n"), 0600)
+
+		So(incrementalSince(), ShouldEqual, time.Date(2026, 10, 16, 12, 30, 0, 500000000, time.UTC))
+	})
+
+	Convey("Should exit when there is neither a -since flag nor a high-water mark", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		since = ""
+		highWaterMarkFile = filepath.Join(dir, "missing.txt")
+
+		So(func() { incrementalSince() },
 			ShouldPanicWith,
-			"error inserting doc: Test generated error")
+			"no -since given and no high-water mark recorded in ["+highWaterMarkFile+"]")
+	})
 
+	Convey("Should select documents updated since the given time", t, func() {
+
+		from := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+		So(updatedSinceFilter(from), ShouldResemble,
+			bson.D{{Key: "updated.at", Value: bson.D{{Key: "$gte", Value: from}}}})
+	})
+}
+
+func TestUnitHandleSignals(t *testing.T) {
+
+	Convey("Should stop reading on the first signal, abort requests on the second and exit on the third", t, func() {
+
+		sigs := make(chan chan<- os.Signal, 1)
+		realNotifySignals := notifySignals
+		notifySignals = func(c chan<- os.Signal, sig ...os.Signal) { sigs <- c }
+		defer func() { notifySignals = realNotifySignals }()
+
+		exitCodes := make(chan int, 1)
+		realExit := exit
+		exit = func(code int) { exitCodes <- code }
+		defer func() { exit = realExit }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		requests, abort := context.WithCancel(context.Background())
+		defer abort()
+
+		handleSignals(cancel, abort)
+		c := <-sigs
+
+		c <- os.Interrupt
+		<-ctx.Done()
+		So(ctx.Err(), ShouldEqual, context.Canceled)
+		So(requests.Err(), ShouldBeNil)
+
+		c <- os.Interrupt
+		<-requests.Done()
+		So(requests.Err(), ShouldEqual, context.Canceled)
+
+		c <- os.Interrupt
+		So(<-exitCodes, ShouldEqual, exitInterrupted)
 	})
 }
 
@@ -396,7 +1011,12 @@ func stubJsonUnmarshalWithEsDocumentCreationResponseError() func() {
 		bulkResponse.Items = make([]esBulkItemResponse, 1)
 		bulkResponse.Items[0] =
 			map[string]esBulkItemResponseData{
-				"create": {Index: "Index", ID: "Id", Status: 500, Error: "Test generated error"},
+				"create": {
+					Index:  "Index",
+					ID:     "Id",
+					Status: 400,
+					Error:  esBulkItemError{Type: "mapper_parsing_exception", Reason: "Test generated error"},
+				},
 			}
 		return nil
 	}
@@ -404,6 +1024,14 @@ func stubJsonUnmarshalWithEsDocumentCreationResponseError() func() {
 	return func() { unmarshal = realUnmarshal }
 }
 
+func stubSleep() func() {
+	// Stub out time.Sleep
+	realSleep := sleep
+	sleep = func(d time.Duration) {}
+	// Return function to restore time.Sleep
+	return func() { sleep = realSleep }
+}
+
 func stubSkipChannel() func() {
 	// Stub out skipChannel
 	realSkipChannel := skipChannel
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+	"github.com/companieshouse/elasticsearch-data-loader/transform"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var fieldMappingFile = ""
+
+// fieldMapping describes how documents are built, if -field-mapping is set.
+var fieldMapping *transform.Mapping
+
+// loadFieldMapping reads and validates the -field-mapping file, if set, exiting if it cannot be used
+func loadFieldMapping() {
+	if fieldMappingFile == "" {
+		return
+	}
+
+	m, err := transform.LoadMapping(fieldMappingFile)
+	if err != nil {
+		fatalf("error loading field mapping [%s]: %s", fieldMappingFile, err)
+	}
+	fieldMapping = m
+	log.Printf("building documents as described by [%s]", fieldMappingFile)
+}
+
+// keepRaw copies raw, the whole MongoDB document company was decoded from, into company if documents are built as
+// described by fieldMapping, which may take fields beyond those decoded
+func keepRaw(company *datastructures.MongoCompany, raw bson.Raw) {
+	if fieldMapping != nil {
+		company.Raw = append(bson.Raw(nil), raw...)
+	}
+}
+
+// newTransformer returns a transform.Transformer building documents as described by fieldMapping, if set, or
+// the built in transform.Transformer if not
+func newTransformer(w write.Writer, f format.Formatter) transform.Transformer {
+	if fieldMapping != nil {
+		return transform.NewMappedTransformer(w, f, fieldMapping)
+	}
+	return transform.NewTransformer(w, f)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+	"github.com/companieshouse/elasticsearch-data-loader/transform"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUnitNewTransformer(t *testing.T) {
+
+	realFieldMappingFile, realFieldMapping := fieldMappingFile, fieldMapping
+	defer func() { fieldMappingFile, fieldMapping = realFieldMappingFile, realFieldMapping }()
+
+	ctrl := gomock.NewController(t)
+	w := write.NewMockWriter(ctrl)
+	f := format.NewFormatter()
+	b, _ := bson.Marshal(bson.M{"_id": "00000001"})
+	raw := bson.Raw(b)
+
+	Convey("Should use the built in transformer without a field mapping", t, func() {
+
+		fieldMappingFile, fieldMapping = "", nil
+		loadFieldMapping()
+
+		So(newTransformer(w, f), ShouldHaveSameTypeAs, &transform.Transform{})
+
+		company := &datastructures.MongoCompany{}
+		keepRaw(company, raw)
+		So(company.Raw, ShouldBeNil)
+	})
+
+	Convey("Should build documents as described by a field mapping when given one", t, func() {
+
+		fieldMappingFile, fieldMapping = "../config/company_mapping.json", nil
+		loadFieldMapping()
+
+		So(newTransformer(w, f), ShouldHaveSameTypeAs, &transform.Mapped{})
+
+		company := &datastructures.MongoCompany{}
+		keepRaw(company, raw)
+		So(company.Raw, ShouldResemble, raw)
+	})
+
+	Convey("Should exit when the field mapping is not valid", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		fieldMappingFile, fieldMapping = "../config/search_scheme.json", nil
+
+		So(loadFieldMapping, ShouldPanicWith,
+			`error loading field mapping [../config/search_scheme.json]: error decoding field mapping: json: unknown field "settings"`)
+	})
+}
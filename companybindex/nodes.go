@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+)
+
+var (
+	discoverNodes = false
+	nodeCoolOff   = 30 * time.Second
+)
+
+// findNodes returns the Elastic Search nodes listed, comma separated, in esDestURL or, if -es-discover-nodes
+// is set, every node in their cluster, asking through r. Over https the nodes given are kept should no node
+// publish a hostname. esDestURL is left naming the first node.
+func findNodes(w write.Writer, r eshttp.Requester) []string {
+	nodes := splitNodes(esDestURL)
+	if len(nodes) == 0 {
+		fatalf("no elasticsearch nodes given in [%s]", esDestURL)
+	}
+	esDestURL = nodes[0]
+
+	if discoverNodes {
+		seeds := nodes
+		c := eshttp.NewClientWithRetryPolicy(w, pooled(r, seeds), retryPolicy)
+		var err error
+		if nodes, err = c.GetNodes(esDestURL); err != nil {
+			fatalf("error discovering elasticsearch nodes from %v: %s", seeds, err)
+		}
+		if len(nodes) == 0 {
+			if !strings.HasPrefix(esDestURL, "https://") {
+				fatalf("no elasticsearch nodes publish an HTTP address")
+			}
+			log.Printf("no elasticsearch nodes publish a hostname to verify their certificates against, using the nodes given %v", seeds)
+			nodes = seeds
+		}
+		esDestURL = nodes[0]
+	}
+
+	if esTLS.InsecureSkipVerify {
+		log.Printf("WARNING: not verifying the certificates of elasticsearch nodes %v", nodes)
+	}
+	return nodes
+}
+
+// pooled returns a Requester spreading requests made through r across nodes, or r itself for a single node
+func pooled(r eshttp.Requester, nodes []string) eshttp.Requester {
+	if len(nodes) == 1 {
+		return r
+	}
+	return eshttp.NewNodePool(r, nodes, nodeCoolOff)
+}
+
+// splitNodes returns the base URLs in a comma separated list
+func splitNodes(list string) []string {
+	var nodes []string
+	for _, node := range strings.Split(list, ",") {
+		if node = strings.TrimSuffix(strings.TrimSpace(node), "/"); node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitSplitNodes(t *testing.T) {
+
+	Convey("Should split a comma separated list of nodes, tidying each", t, func() {
+
+		So(splitNodes("http://es1:9200/, http://es2:9200,,"), ShouldResemble, []string{"http://es1:9200", "http://es2:9200"})
+		So(splitNodes(""), ShouldBeEmpty)
+	})
+}
+
+func TestUnitFindNodes(t *testing.T) {
+
+	realESDestURL, realDiscoverNodes := esDestURL, discoverNodes
+	defer func() { esDestURL, discoverNodes = realESDestURL, realDiscoverNodes }()
+
+	Convey("Should use the nodes given", t, func() {
+
+		esDestURL, discoverNodes = "http://es1:9200/,http://es2:9200", false
+
+		ctrl := gomock.NewController(t)
+
+		So(findNodes(write.NewMockWriter(ctrl), eshttp.NewMockRequester(ctrl)), ShouldResemble, []string{"http://es1:9200", "http://es2:9200"})
+		So(esDestURL, ShouldEqual, "http://es1:9200")
+	})
+
+	Convey("Should use the nodes discovered in the cluster", t, func() {
+
+		esDestURL, discoverNodes = "http://es-seed:9200", true
+
+		ctrl := gomock.NewController(t)
+		requester := eshttp.NewMockRequester(ctrl)
+
+		requester.EXPECT().Do(http.MethodGet, nil, "http://es-seed:9200/_nodes/http").Return(&http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(bytes.NewBufferString(`{"nodes":{` +
+				`"a":{"http":{"publish_address":"10.0.0.1:9200"}},` +
+				`"b":{"http":{"publish_address":"10.0.0.2:9200"}}}}`)),
+		}, nil)
+
+		So(findNodes(write.NewMockWriter(ctrl), requester), ShouldResemble, []string{"http://10.0.0.1:9200", "http://10.0.0.2:9200"})
+		So(esDestURL, ShouldEqual, "http://10.0.0.1:9200")
+	})
+
+	Convey("Should keep the nodes given when no node publishes a hostname over https", t, func() {
+
+		esDestURL, discoverNodes = "https://es-seed:9200", true
+
+		ctrl := gomock.NewController(t)
+		requester := eshttp.NewMockRequester(ctrl)
+
+		requester.EXPECT().Do(http.MethodGet, nil, "https://es-seed:9200/_nodes/http").Return(&http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"nodes":{"a":{"http":{"publish_address":"10.0.0.1:9200"}}}}`)),
+		}, nil)
+
+		So(findNodes(write.NewMockWriter(ctrl), requester), ShouldResemble, []string{"https://es-seed:9200"})
+		So(esDestURL, ShouldEqual, "https://es-seed:9200")
+	})
+}
+
+func TestUnitPooled(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	requester := eshttp.NewMockRequester(ctrl)
+
+	Convey("Should use a single node directly", t, func() {
+
+		So(pooled(requester, []string{"http://es1:9200"}), ShouldEqual, requester)
+	})
+
+	Convey("Should spread requests across several nodes", t, func() {
+
+		So(pooled(requester, []string{"http://es1:9200", "http://es2:9200"}), ShouldHaveSameTypeAs, &eshttp.NodePool{})
+	})
+}
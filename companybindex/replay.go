@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+)
+
+// replay resubmits the documents recorded in a dead-letter file to Elastic Search, in bulks limited by
+// -bulk-max-docs and -bulk-max-bytes.
+// Documents which fail again are recorded in the current dead-letter file.
+func replay(w write.Writer, dl write.DeadLetterWriter) {
+	deadLetters, err := write.ReadDeadLetters(replayFile)
+	if err != nil {
+		fatalf("error reading dead-letter file [%s]: %s", replayFile, err)
+	}
+
+	go status()
+
+	c := eshttp.NewClientWithRetryPolicy(w, esRequester, retryPolicy)
+
+	items := make([]bulkItem, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		items = append(items, deadLetterBulkItem(deadLetter))
+	}
+
+	for _, bulk := range splitBulk(items, bulkMaxDocs, bulkMaxBytes) {
+		countChannel <- len(bulk)
+		written, _ := submitBulkToES(c, w, dl, bulk)
+		insertChannel <- written
+		if failed := len(bulk) - written; failed > 0 {
+			failChannel <- failed
+		}
+	}
+
+	w.Close()
+	dl.Close()
+
+	close(statusStop)
+	<-statusDone
+
+	log.Printf("REPLAYED: %d documents from [%s]", len(deadLetters), replayFile)
+}
+
+// sameFile reports whether two paths refer to the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// exitInterrupted is the exit code used when a load is stopped by a signal. Everything up to the
+// checkpoint has been loaded, so the run can be picked up again with -resume.
+const exitInterrupted = 3
+
+// requestContext is the context of requests sending documents to Elastic Search, which abortRequests cancels.
+var requestContext, abortRequests = context.WithCancel(context.Background())
+
+// Function variables to facilitate testing.
+var (
+	notifySignals = signal.Notify
+	exit          = os.Exit
+)
+
+// fatalHooks are run by logFatalf before exiting, each under the number onFatal registered it with.
+var (
+	fatalHooksMu sync.Mutex
+	fatalHooks   = make(map[int]func())
+	nextHook     int
+)
+
+// onFatal registers hook to be run should the loader exit on a fatal error, returning a function with which
+// to unregister it
+func onFatal(hook func()) func() {
+	fatalHooksMu.Lock()
+	defer fatalHooksMu.Unlock()
+
+	n := nextHook
+	nextHook++
+	fatalHooks[n] = hook
+	return func() {
+		fatalHooksMu.Lock()
+		defer fatalHooksMu.Unlock()
+
+		delete(fatalHooks, n)
+	}
+}
+
+// logFatalf logs as log.Fatalf does, then runs the hooks registered with onFatal before exiting. The hooks are
+// unregistered first, so a fatal error within one of them exits straight away.
+func logFatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+
+	fatalHooksMu.Lock()
+	hooks := fatalHooks
+	fatalHooks = make(map[int]func())
+	fatalHooksMu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	exit(1)
+}
+
+// handleSignals cancels the read of the Mongo cursor on the first SIGINT or SIGTERM, leaving batches
+// already in flight to drain. A second signal aborts the requests of those batches, leaving them to be
+// reread on resume, and a third exits immediately.
+func handleSignals(cancel context.CancelFunc, abort context.CancelFunc) {
+	sigs := make(chan os.Signal, 3)
+	notifySignals(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		log.Printf("received %s: no more documents will be read, waiting for in-flight batches to finish", sig)
+		cancel()
+
+		sig = <-sigs
+		log.Printf("received %s again: aborting requests of in-flight batches", sig)
+		abort()
+
+		sig = <-sigs
+		log.Printf("received %s a third time: exiting without waiting for in-flight batches", sig)
+		exit(exitInterrupted)
+	}()
+}
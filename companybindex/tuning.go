@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/companieshouse/elasticsearch-data-loader/checkpoint"
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+)
+
+const (
+	refreshIntervalSetting  = "index.refresh_interval"
+	numberOfReplicasSetting = "index.number_of_replicas"
+)
+
+var (
+	tuneBulkLoad       = false
+	forceMergeSegments = 0
+
+	// tunedSettingsFile records the settings a tuned index is to be restored to, until they have been.
+	tunedSettingsFile = "tunedSettings.json"
+)
+
+// removeFile is a function variable to facilitate testing.
+var removeFile = os.Remove
+
+// bulkLoadSettings are applied to the destination index for the duration of a tuned load
+var bulkLoadSettings = indexSettings{RefreshInterval: "-1", NumberOfReplicas: "0"}
+
+type indexSettings struct {
+	RefreshInterval  string `json:"refresh_interval"`
+	NumberOfReplicas string `json:"number_of_replicas"`
+}
+
+// tuneForBulkLoad records the refresh interval and replica count of index in -tuned-settings-file before
+// disabling both, returning a function to call once the load has drained. That function restores the recorded
+// settings, refreshes the index and, if -force-merge-segments is set and the load was not interrupted,
+// force-merges it through m, which is to neither time out nor resend requests. Until then a fatal error restores
+// the settings before exiting. Should a load die without restoring them, the next tuned load restores the
+// settings recorded by the one before.
+func tuneForBulkLoad(c eshttp.Client, m eshttp.Client, index string) func(interrupted bool) {
+	original, recorded := loadTunedSettings()
+	if !recorded {
+		original = currentSettings(c, index)
+		if original == bulkLoadSettings {
+			fatalf("index [%s] already has refresh_interval %s and number_of_replicas %s, and [%s] records no settings to restore it to",
+				index, bulkLoadSettings.RefreshInterval, bulkLoadSettings.NumberOfReplicas, tunedSettingsFile)
+		}
+		saveTunedSettings(original)
+	}
+
+	putIndexSettings(c, index, bulkLoadSettings)
+	log.Printf("tuned index [%s] for bulk loading: refresh_interval %s, number_of_replicas %s (were %s and %s)",
+		index, bulkLoadSettings.RefreshInterval, bulkLoadSettings.NumberOfReplicas, original.RefreshInterval, original.NumberOfReplicas)
+
+	var once sync.Once
+	restore := func() {
+		once.Do(func() {
+			putIndexSettings(c, index, original)
+			if err := removeFile(tunedSettingsFile); err != nil {
+				log.Printf("error removing tuned settings file [%s]: %s", tunedSettingsFile, err)
+			}
+			log.Printf("restored index [%s] to refresh_interval %s, number_of_replicas %s", index, original.RefreshInterval, original.NumberOfReplicas)
+		})
+	}
+
+	unregister := onFatal(restore)
+
+	return func(interrupted bool) {
+		unregister()
+		restore()
+
+		if err := m.Refresh(esDestURL, index); err != nil {
+			log.Printf("error refreshing index [%s]: %s", index, err)
+		}
+
+		// Merging a partly loaded index is wasted effort when the resumed load will add to it.
+		if forceMergeSegments > 0 && !interrupted {
+			log.Printf("force-merging index [%s] to %d segment(s)", index, forceMergeSegments)
+			if err := m.ForceMerge(esDestURL, index, forceMergeSegments); err != nil {
+				log.Printf("error force-merging index [%s]: %s", index, err)
+			}
+		}
+	}
+}
+
+// currentSettings returns the refresh interval and replica count of index, exiting if either is unknown
+func currentSettings(c eshttp.Client, index string) indexSettings {
+	settings, err := c.GetSettings(esDestURL, index)
+	if err != nil {
+		fatalf("error reading settings of index [%s]: %s", index, err)
+	}
+
+	current := indexSettings{
+		RefreshInterval:  settings[refreshIntervalSetting],
+		NumberOfReplicas: settings[numberOfReplicasSetting],
+	}
+	if current.RefreshInterval == "" || current.NumberOfReplicas == "" {
+		fatalf("index [%s] reported no %s or %s setting to restore after loading", index, refreshIntervalSetting, numberOfReplicasSetting)
+	}
+	return current
+}
+
+// loadTunedSettings returns the settings recorded by a tuned load which has not yet restored them, if any
+func loadTunedSettings() (indexSettings, bool) {
+	var settings indexSettings
+	value, err := checkpoint.Load(tunedSettingsFile)
+	if err != nil {
+		fatalf("error reading tuned settings file [%s]: %s", tunedSettingsFile, err)
+	}
+	if value == "" {
+		return settings, false
+	}
+
+	if err := unmarshal([]byte(value), &settings); err != nil {
+		fatalf("error unmarshalling tuned settings file [%s]: %s", tunedSettingsFile, err)
+	}
+	return settings, true
+}
+
+// saveTunedSettings records the settings to restore a tuned index to, exiting if they cannot be recorded
+func saveTunedSettings(settings indexSettings) {
+	b, err := marshal(settings)
+	if err != nil {
+		fatalf("error marshal to json: %s", err)
+	}
+	if err := checkpoint.Save(tunedSettingsFile, string(b)); err != nil {
+		fatalf("error writing tuned settings file [%s]: %s", tunedSettingsFile, err)
+	}
+}
+
+// putIndexSettings applies settings to index, exiting if Elastic Search refuses them
+func putIndexSettings(c eshttp.Client, index string, settings indexSettings) {
+	body, err := marshal(map[string]indexSettings{"index": settings})
+	if err != nil {
+		fatalf("error marshal to json: %s", err)
+	}
+
+	if err := c.PutSettings(esDestURL, index, body); err != nil {
+		fatalf("error setting refresh_interval %s and number_of_replicas %s on index [%s]: %s",
+			settings.RefreshInterval, settings.NumberOfReplicas, index, err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitTuneForBulkLoad(t *testing.T) {
+
+	realForceMergeSegments := forceMergeSegments
+	defer func() { forceMergeSegments = realForceMergeSegments }()
+
+	dir, _ := ioutil.TempDir("", "companybindex")
+	defer os.RemoveAll(dir)
+
+	realTunedSettingsFile := tunedSettingsFile
+	tunedSettingsFile = filepath.Join(dir, "tunedSettings.json")
+	defer func() { tunedSettingsFile = realTunedSettingsFile }()
+
+	original := map[string]string{
+		refreshIntervalSetting:    "30s",
+		numberOfReplicasSetting:   "1",
+		"index.max_result_window": "10000",
+	}
+	tuned := []byte(`{"index":{"refresh_interval":"-1","number_of_replicas":"0"}}`)
+	restored := []byte(`{"index":{"refresh_interval":"30s","number_of_replicas":"1"}}`)
+
+	Convey("Should disable refresh and replicas, then restore them, refresh and force-merge after a complete load", t, func() {
+
+		forceMergeSegments = 1
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		gomock.InOrder(
+			client.EXPECT().GetSettings(esDestURL, esDestIndex).Return(original, nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, tuned).Return(nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, restored).Return(nil),
+			client.EXPECT().Refresh(esDestURL, esDestIndex).Return(nil),
+			client.EXPECT().ForceMerge(esDestURL, esDestIndex, 1).Return(nil),
+		)
+
+		restore := tuneForBulkLoad(client, client, esDestIndex)
+		_, err := os.Stat(tunedSettingsFile)
+		So(err, ShouldBeNil)
+
+		restore(false)
+		_, err = os.Stat(tunedSettingsFile)
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+
+	Convey("Should restore the settings but not force-merge after an interrupted load", t, func() {
+
+		forceMergeSegments = 1
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		gomock.InOrder(
+			client.EXPECT().GetSettings(esDestURL, esDestIndex).Return(original, nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, tuned).Return(nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, restored).Return(nil),
+			client.EXPECT().Refresh(esDestURL, esDestIndex).Return(errors.New("timed out")),
+		)
+
+		restore := tuneForBulkLoad(client, client, esDestIndex)
+		restore(true)
+	})
+
+	Convey("Should exit without touching the index when its settings cannot be read", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().GetSettings(esDestURL, esDestIndex).Return(nil, errors.New("index_not_found_exception"))
+
+		So(func() { tuneForBulkLoad(client, client, esDestIndex) },
+			ShouldPanicWith,
+			"error reading settings of index ["+esDestIndex+"]: index_not_found_exception")
+	})
+
+	Convey("Should restore the settings recorded by a load which died without restoring them", t, func() {
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		saveTunedSettings(indexSettings{RefreshInterval: "30s", NumberOfReplicas: "1"})
+
+		gomock.InOrder(
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, tuned).Return(nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, restored).Return(nil),
+			client.EXPECT().Refresh(esDestURL, esDestIndex).Return(nil),
+		)
+
+		restore := tuneForBulkLoad(client, client, esDestIndex)
+		restore(true)
+	})
+
+	Convey("Should refuse to tune an index which is already tuned when no settings are recorded", t, func() {
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		client.EXPECT().GetSettings(esDestURL, esDestIndex).
+			Return(map[string]string{refreshIntervalSetting: "-1", numberOfReplicasSetting: "0"}, nil)
+
+		So(func() { tuneForBulkLoad(client, client, esDestIndex) },
+			ShouldPanicWith,
+			"index ["+esDestIndex+"] already has refresh_interval -1 and number_of_replicas 0, and ["+
+				tunedSettingsFile+"] records no settings to restore it to")
+	})
+
+	Convey("Should restore the settings before exiting on a fatal error", t, func() {
+
+		realExit := exit
+		exit = func(code int) { panic(code) }
+		defer func() { exit = realExit }()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		gomock.InOrder(
+			client.EXPECT().GetSettings(esDestURL, esDestIndex).Return(original, nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, tuned).Return(nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, restored).Return(nil),
+		)
+
+		tuneForBulkLoad(client, client, esDestIndex)
+
+		So(func() { logFatalf("error reading from collection: %s", "timed out") }, ShouldPanicWith, 1)
+		_, err := os.Stat(tunedSettingsFile)
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+	Convey("Should not restore the settings on a fatal error once they have been restored", t, func() {
+
+		realExit := exit
+		exit = func(code int) { panic(code) }
+		defer func() { exit = realExit }()
+
+		ctrl := gomock.NewController(t)
+		client := eshttp.NewMockClient(ctrl)
+
+		gomock.InOrder(
+			client.EXPECT().GetSettings(esDestURL, esDestIndex).Return(original, nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, tuned).Return(nil),
+			client.EXPECT().PutSettings(esDestURL, esDestIndex, restored).Return(nil),
+			client.EXPECT().Refresh(esDestURL, esDestIndex).Return(nil),
+		)
+
+		tuneForBulkLoad(client, client, esDestIndex)(true)
+
+		So(func() { logFatalf("error disconnecting from client: %s", "timed out") }, ShouldPanicWith, 1)
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/companieshouse/elasticsearch-data-loader/alphakey"
+	"github.com/companieshouse/elasticsearch-data-loader/checkpoint"
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+	"github.com/companieshouse/elasticsearch-data-loader/transform"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const modeWatch = "watch"
+
+var resumeTokenFile = "resumeToken.json"
+
+// changeEvent holds the parts of a change stream event needed to bring Elastic Search up to date
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *datastructures.MongoCompany `bson:"fullDocument"`
+}
+
+// watch tails the mongoDB collection through a change stream, applying each change to Elastic Search until
+// interrupted. The stream's resume token is persisted after every batch so a restarted watch carries on
+// from where the last one stopped.
+func watch(w write.Writer, f format.Formatter, dl write.DeadLetterWriter) {
+	client, disconnect := connectToMongo()
+	defer disconnect()
+
+	streamOptions := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token := loadResumeToken(); token != nil {
+		log.Printf("resuming change stream after token %s", token)
+		streamOptions.SetResumeAfter(token)
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{{
+		Key: "$in", Value: bson.A{"insert", "update", "replace", "delete"},
+	}}}}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleSignals(cancel, abortRequests)
+
+	collection := client.Database(mongoDatabase).Collection(mongoCollection)
+	cs, err := collection.Watch(ctx, pipeline, streamOptions)
+	if err != nil {
+		fatalf("error opening change stream: %s", err)
+	}
+	defer cs.Close(context.Background())
+
+	go status()
+
+	t := newTransformer(w, f)
+	c := eshttp.NewClientWithRetryPolicy(w, esRequester, retryPolicy)
+	ak, fallback := alphaKeyGenerator, alphaKeyFallback
+
+	// Changes overwrite whatever an earlier load or change left behind.
+	bulkAction = "index"
+
+	// held is set once a company could not be given alpha keys, from when the saved position stays put.
+	held := false
+
+	for {
+		events := nextChangeEvents(ctx, cs)
+		if len(events) == 0 {
+			break
+		}
+
+		items, skipped, keyed := changeEventsToBulkItems(t, ak, fallback, w, events)
+
+		countChannel <- len(events)
+		if skipped > 0 {
+			skipChannel <- skipped
+		}
+		if len(items) > 0 {
+			written, _ := submitBulksToES(c, w, dl, items)
+			insertChannel <- written
+			if failed := len(items) - written; failed > 0 {
+				failChannel <- failed
+			}
+		}
+
+		// Aborted changes were neither written nor dead-lettered, so the stream must resume before them.
+		if requestContext.Err() != nil {
+			break
+		}
+
+		// Companies without alpha keys were neither written nor dead-lettered, so the stream must resume
+		// before them.
+		if !keyed && !held {
+			held = true
+			log.Printf("companies without alpha keys, change stream position left in [%s] for them to be reread", resumeTokenFile)
+		}
+
+		// Anything else that failed has been dead-lettered for replay, so the stream moves on regardless.
+		if !held {
+			saveResumeToken(cs.ResumeToken())
+		}
+	}
+
+	if err := cs.Err(); err != nil && ctx.Err() == nil {
+		fatalf("error reading change stream: %s", err)
+	}
+
+	w.Close()
+	dl.Close()
+
+	close(statusStop)
+	<-statusDone
+
+	log.Printf("STOPPED WATCHING: change stream position saved to [%s]", resumeTokenFile)
+}
+
+// nextChangeEvents blocks until at least one change is available, then returns it along with any further
+// changes already waiting, up to mongoSize. It returns no events once ctx is cancelled or the stream fails.
+func nextChangeEvents(ctx context.Context, cs *mongo.ChangeStream) []changeEvent {
+	var events []changeEvent
+
+	for more := cs.Next(ctx); more; more = len(events) < mongoSize && cs.TryNext(ctx) {
+		var event changeEvent
+		if err := cs.Decode(&event); err != nil {
+			fatalf("error decoding change event: %s", err)
+		}
+		if doc, ok := cs.Current.Lookup("fullDocument").DocumentOK(); ok && event.FullDocument != nil {
+			keepRaw(event.FullDocument, doc)
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// changeEventsToBulkItems returns the bulk items which apply events to Elastic Search, fetching alpha keys
+// for just the companies inserted or updated. Where a company changed more than once only its last change
+// is applied, as that reflects its current state. It also returns the number of events skipped as superseded
+// or already deleted; companies which cannot be transformed are sent to skipChannel as they are skipped. Last, it
+// returns whether every company was given alpha keys.
+func changeEventsToBulkItems(t transform.Transformer, c alphakey.Generator, fallback alphakey.Generator, w write.Writer, events []changeEvent) ([]bulkItem, int, bool) {
+	latest := make(map[string]int)
+	for i, event := range events {
+		latest[event.DocumentKey.ID] = i
+	}
+
+	var items []bulkItem
+	var companies []*datastructures.MongoCompany
+	skipped, keyed := 0, true
+
+	for i, event := range events {
+		switch {
+		case latest[event.DocumentKey.ID] != i:
+			skipped++
+		case event.OperationType == "delete":
+			items = append(items, newDeleteBulkItem(event.DocumentKey.ID))
+		case event.FullDocument == nil:
+			// The company was deleted before the update could be looked up; its delete follows.
+			skipped++
+		default:
+			companies = append(companies, event.FullDocument)
+		}
+	}
+
+	if len(companies) > 0 {
+		// Aborted changes are left for the stream to resume before.
+		err, alphaKeys := getAlphaKeys(t, &companies, len(companies), c, fallback, w)
+		if err != nil {
+			return nil, skipped, false
+		}
+
+		items, _, keyed = transformMongoCompaniesToEsCompanies(len(companies), t, &companies, alphaKeys, items, len(companies))
+	}
+
+	return items, skipped, keyed
+}
+
+// loadResumeToken returns the change stream resume token saved by a previous watch, if any
+func loadResumeToken() bson.Raw {
+	value, err := checkpoint.Load(resumeTokenFile)
+	if err != nil {
+		fatalf("error reading resume token file [%s]: %s", resumeTokenFile, err)
+	}
+	if value == "" {
+		return nil
+	}
+
+	var token bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(value), false, &token); err != nil {
+		fatalf("error parsing resume token [%s]: %s", value, err)
+	}
+	return token
+}
+
+// saveResumeToken persists a change stream resume token, logging rather than stopping the watch if it cannot
+func saveResumeToken(token bson.Raw) {
+	if token == nil {
+		return
+	}
+
+	value, err := bson.MarshalExtJSON(token, false, false)
+	if err != nil {
+		log.Printf("error marshalling resume token %s: %s", token, err)
+		return
+	}
+
+	if err := checkpoint.Save(resumeTokenFile, string(value)); err != nil {
+		log.Printf("error writing resume token to file [%s]: %s", resumeTokenFile, err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/eshttp"
+	"github.com/companieshouse/elasticsearch-data-loader/transform"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUnitChangeEventsToBulkItems(t *testing.T) {
+
+	Convey("Should index the latest state of changed companies and delete removed ones", t, func() {
+
+		realBulkAction := bulkAction
+		bulkAction = "index"
+		defer func() { bulkAction = realBulkAction }()
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		client := eshttp.NewMockClient(ctrl)
+
+		first := &datastructures.MongoCompany{ID: "00000001", Data: &datastructures.MongoData{CompanyName: "FIRST LTD"}}
+		renamed := &datastructures.MongoCompany{ID: "00000001", Data: &datastructures.MongoData{CompanyName: "RENAMED LTD"}}
+
+		events := []changeEvent{
+			changeEventFor("insert", "00000001", first),
+			changeEventFor("update", "00000002", nil),
+			changeEventFor("delete", "00000002", nil),
+			changeEventFor("update", "00000001", renamed),
+		}
+
+		companies := []*datastructures.MongoCompany{renamed}
+		companyNames := []datastructures.CompanyName{{Name: "RENAMED LTD"}}
+		companyNamesBody, _ := json.Marshal(companyNames)
+		alphaKey := datastructures.AlphaKey{SameAsAlphaKey: "RENAMED", OrderedAlphaKey: "RENAMED"}
+
+		transformer.EXPECT().GetCompanyNames(&companies, 1).Return(companyNames)
+		client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).
+			Return([]byte(`[{"sameAsAlphaKey":"RENAMED","orderedAlphaKey":"RENAMED"}]`), nil)
+		transformer.EXPECT().TransformMongoCompanyToEsCompany(renamed, &alphaKey, nil).
+			Return(&datastructures.EsCompany{ID: "00000001"})
+
+		items, skipped, keyed := changeEventsToBulkItems(transformer, client, client, write.NewMockWriter(ctrl), events)
+
+		So(skipped, ShouldEqual, 2)
+		So(keyed, ShouldBeTrue)
+		So(len(items), ShouldEqual, 2)
+		So(string(bulkBody(items)), ShouldStartWith,
+			"{ \"delete\": { \"_id\": \"00000002\" } }\n{ \"index\": { \"_id\": \"00000001\" } }\n{\"ID\":\"00000001\"")
+	})
+
+	Convey("Should leave companies which cannot be transformed out of the events it reports skipped", t, func() {
+
+		restoreSkipChannel := stubSkipChannel()
+		defer restoreSkipChannel()
+
+		ctrl := gomock.NewController(t)
+		transformer := transform.NewMockTransformer(ctrl)
+		client := eshttp.NewMockClient(ctrl)
+
+		company := &datastructures.MongoCompany{ID: "00000001", Data: &datastructures.MongoData{CompanyName: "FIRST LTD"}}
+		events := []changeEvent{changeEventFor("insert", "00000001", company)}
+
+		companies := []*datastructures.MongoCompany{company}
+		companyNames := []datastructures.CompanyName{{Name: "FIRST LTD"}}
+		companyNamesBody, _ := json.Marshal(companyNames)
+		alphaKey := datastructures.AlphaKey{SameAsAlphaKey: "FIRST", OrderedAlphaKey: "FIRST"}
+
+		transformer.EXPECT().GetCompanyNames(&companies, 1).Return(companyNames)
+		client.EXPECT().GetAlphaKeys(companyNamesBody, alphakeyURL).
+			Return([]byte(`[{"sameAsAlphaKey":"FIRST","orderedAlphaKey":"FIRST"}]`), nil)
+		transformer.EXPECT().TransformMongoCompanyToEsCompany(company, &alphaKey, nil).Return(nil)
+
+		increments := make(chan int, 1)
+		go func() { increments <- <-skipChannel }()
+
+		items, skipped, keyed := changeEventsToBulkItems(transformer, client, client, write.NewMockWriter(ctrl), events)
+
+		So(<-increments, ShouldEqual, 1)
+		So(skipped, ShouldEqual, 0)
+		So(keyed, ShouldBeTrue)
+		So(items, ShouldBeEmpty)
+	})
+}
+
+func TestUnitResumeToken(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "companybindex")
+	defer os.RemoveAll(dir)
+
+	realResumeTokenFile := resumeTokenFile
+	defer func() { resumeTokenFile = realResumeTokenFile }()
+
+	Convey("Should have no resume token before one has been saved", t, func() {
+
+		resumeTokenFile = filepath.Join(dir, "missing.json")
+
+		So(loadResumeToken(), ShouldBeNil)
+	})
+
+	Convey("Should load the resume token that was saved", t, func() {
+
+		resumeTokenFile = filepath.Join(dir, "resumeToken.json")
+		token, _ := bson.Marshal(bson.D{{Key: "_data", Value: "8263A1B2C3000000012B022C0100296E5A1004"}})
+
+		saveResumeToken(token)
+
+		So(loadResumeToken(), ShouldResemble, bson.Raw(token))
+	})
+}
+
+func changeEventFor(operationType string, id string, fullDocument *datastructures.MongoCompany) changeEvent {
+	event := changeEvent{OperationType: operationType, FullDocument: fullDocument}
+	event.DocumentKey.ID = id
+	return event
+}
@@ -0,0 +1,145 @@
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// latencyFactor is how far smoothed latency may rise above the best seen before the worker count is reduced
+const latencyFactor = 2
+
+// smoothing is the weight given to each new latency observation in the moving average
+const smoothing = 0.3
+
+// Controller provides an interface by which workers take turns within a limit that rises while their work
+// completes promptly and falls when it is rejected or slows down
+type Controller interface {
+	Acquire(ctx context.Context) bool
+	Release()
+	Observe(took time.Duration, rejected bool)
+	Workers() int
+}
+
+// Control provides a concrete implementation of the Controller interface, raising the limit by one worker
+// after each round of healthy observations and halving it on a rejection or rising latency
+type Control struct {
+	mu       sync.Mutex
+	min      int
+	max      int
+	limit    int
+	active   int
+	healthy  int
+	cooldown int
+	latency  time.Duration
+	best     time.Duration
+	wake     chan struct{}
+}
+
+// NewController returns a concrete implementation of the Controller interface which allows between min and
+// max workers, starting at min
+func NewController(min int, max int) Controller {
+
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return &Control{
+		min:   min,
+		max:   max,
+		limit: min,
+		wake:  make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a worker may start, returning false without starting one if ctx is done first
+func (c *Control) Acquire(ctx context.Context) bool {
+	for {
+		c.mu.Lock()
+		if c.active < c.limit {
+			c.active++
+			c.mu.Unlock()
+			return true
+		}
+		wake := c.wake
+		c.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Release marks a worker started by Acquire as finished
+func (c *Control) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	c.notify()
+}
+
+// Observe records how long a piece of work took and whether any of it was rejected, adjusting the limit
+func (c *Control) Observe(took time.Duration, rejected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !rejected {
+		if c.latency == 0 {
+			c.latency = took
+		} else {
+			c.latency += time.Duration(smoothing * float64(took-c.latency))
+		}
+		if c.best == 0 || c.latency < c.best {
+			c.best = c.latency
+		}
+	}
+
+	// Work already in flight when the limit was cut reflects the old limit, so is not held against the new one.
+	if c.cooldown > 0 {
+		c.cooldown--
+		return
+	}
+
+	if rejected || c.latency > latencyFactor*c.best {
+		c.healthy = 0
+		if c.limit == c.min && !rejected {
+			// Slow even at the fewest workers, so this is the latency to expect from now on.
+			c.best = c.latency
+		}
+		if c.limit > c.min {
+			c.limit /= 2
+			if c.limit < c.min {
+				c.limit = c.min
+			}
+			c.cooldown = c.active
+		}
+		return
+	}
+
+	c.healthy++
+	if c.healthy >= c.limit && c.limit < c.max {
+		c.healthy = 0
+		c.limit++
+		c.notify()
+	}
+}
+
+// Workers returns the number of workers currently allowed
+func (c *Control) Workers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.limit
+}
+
+// notify wakes every goroutine blocked in Acquire so that they check the limit again. It must be called
+// with mu held.
+func (c *Control) notify() {
+	close(c.wake)
+	c.wake = make(chan struct{})
+}
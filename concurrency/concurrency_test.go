@@ -0,0 +1,146 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitNewController(t *testing.T) {
+
+	Convey("Should start at the minimum number of workers", t, func() {
+
+		So(NewController(2, 8).Workers(), ShouldEqual, 2)
+	})
+
+	Convey("Should allow at least one worker, and no fewer at most than at least", t, func() {
+
+		c := NewController(0, 0).(*Control)
+
+		So(c.min, ShouldEqual, 1)
+		So(c.max, ShouldEqual, 1)
+	})
+}
+
+func TestUnitObserve(t *testing.T) {
+
+	Convey("Given a controller allowing between 2 and 4 workers", t, func() {
+
+		c := NewController(2, 4)
+
+		Convey("When a round of work completes promptly", func() {
+
+			c.Observe(time.Second, false)
+			c.Observe(time.Second, false)
+
+			Convey("Then another worker should be allowed", func() {
+
+				So(c.Workers(), ShouldEqual, 3)
+			})
+
+			Convey("Then no more than the maximum should ever be allowed", func() {
+
+				for i := 0; i < 20; i++ {
+					c.Observe(time.Second, false)
+				}
+				So(c.Workers(), ShouldEqual, 4)
+			})
+		})
+
+		Convey("When work is rejected", func() {
+
+			for i := 0; i < 20; i++ {
+				c.Observe(time.Second, false)
+			}
+			c.Observe(0, true)
+
+			Convey("Then the number of workers should be halved", func() {
+
+				So(c.Workers(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When latency rises well beyond the best seen", func() {
+
+			for i := 0; i < 20; i++ {
+				c.Observe(time.Second, false)
+			}
+			for i := 0; i < 3; i++ {
+				c.Observe(5*time.Second, false)
+			}
+
+			Convey("Then the number of workers should be reduced", func() {
+
+				So(c.Workers(), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a controller whose limit has just been cut with workers in flight", t, func() {
+
+		c := NewController(1, 8)
+		for i := 0; i < 10; i++ {
+			c.Observe(time.Second, false)
+		}
+		So(c.Workers(), ShouldEqual, 5)
+		for i := 0; i < 4; i++ {
+			So(c.Acquire(context.Background()), ShouldBeTrue)
+		}
+		c.Observe(0, true)
+		So(c.Workers(), ShouldEqual, 2)
+
+		Convey("Then rejections from the work already in flight should not cut it again", func() {
+
+			for i := 0; i < 4; i++ {
+				c.Observe(0, true)
+			}
+			So(c.Workers(), ShouldEqual, 2)
+
+			c.Observe(0, true)
+			So(c.Workers(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestUnitAcquire(t *testing.T) {
+
+	Convey("Given a controller allowing a single worker which is busy", t, func() {
+
+		c := NewController(1, 2)
+		So(c.Acquire(context.Background()), ShouldBeTrue)
+
+		Convey("Then another worker should wait until the first is released", func() {
+
+			acquired := make(chan bool)
+			go func() { acquired <- c.Acquire(context.Background()) }()
+
+			select {
+			case <-acquired:
+				So("acquired while busy", ShouldBeEmpty)
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			c.Release()
+			So(<-acquired, ShouldBeTrue)
+		})
+
+		Convey("Then another worker should start as soon as the limit is raised", func() {
+
+			acquired := make(chan bool)
+			go func() { acquired <- c.Acquire(context.Background()) }()
+
+			c.Observe(time.Second, false)
+			So(<-acquired, ShouldBeTrue)
+		})
+
+		Convey("Then a waiting worker should give up once its context is cancelled", func() {
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			So(c.Acquire(ctx), ShouldBeFalse)
+		})
+	})
+}
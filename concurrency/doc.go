@@ -0,0 +1,2 @@
+// Package concurrency provides a limit on concurrent work which adapts to how well the work is being received
+package concurrency
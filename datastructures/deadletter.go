@@ -0,0 +1,17 @@
+package datastructures
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter holds a document which could not be written to Elastic Search, along with the bulk action
+// line it was sent with and the reason it failed, so that it can later be replayed
+type DeadLetter struct {
+	ID        string          `json:"id"`
+	Action    json.RawMessage `json:"action"`
+	Document  json.RawMessage `json:"document"`
+	Reason    string          `json:"reason"`
+	Status    int             `json:"status"`
+	Timestamp time.Time       `json:"timestamp"`
+}
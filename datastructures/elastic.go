@@ -1,6 +1,9 @@
 package datastructures
 
-// EsCompany holds a set of items containing company data relevant to Elastic Search
+import "encoding/json"
+
+// EsCompany holds a set of items containing company data relevant to Elastic Search. A Document, if set,
+// is indexed in place of the other fields.
 type EsCompany struct {
 	ID                    string
 	CompanyType           string   `json:"company_type"`
@@ -8,18 +11,49 @@ type EsCompany struct {
 	Kind                  string   `json:"kind"`
 	Links                 *EsLinks `json:"links"`
 	OrderedAlphaKeyWithID string   `json:"ordered_alpha_key_with_id"`
+	AlphaKeyWithID        string   `json:"alpha_key_with_id"`
+	CorporateStripped     string   `json:"corporate_stripped"`
+	CorporateStrippedLen  int      `json:"corporate_stripped_len"`
+	CorporateWithType     string   `json:"corporate_with_type"`
+	ActiveCount           int      `json:"active_count"`
+
+	Document map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON encodes the Document of an EsCompany if it has one, or its fields if not
+func (c EsCompany) MarshalJSON() ([]byte, error) {
+	if c.Document != nil {
+		return json.Marshal(c.Document)
+	}
+	type company EsCompany
+	return json.Marshal(company(c))
 }
 
 // EsItem holds an individual company's data
 type EsItem struct {
-	CompanyNumber       string `json:"company_number"`
-	CompanyStatus       string `json:"company_status,omitempty"`
-	CorporateName       string `json:"corporate_name"`
-	CorporateNameStart  string `json:"corporate_name_start"`
-	CorporateNameEnding string `json:"corporate_name_ending,omitempty"`
-	RecordType          string `json:"record_type"`
-	AlphaKey            string `json:"alpha_key"`
-	OrderedAlphaKey     string `json:"ordered_alpha_key"`
+	CompanyNumber                  string           `json:"company_number"`
+	CompanyStatus                  string           `json:"company_status,omitempty"`
+	CorporateName                  string           `json:"corporate_name"`
+	CorporateNameStart             string           `json:"corporate_name_start"`
+	CorporateNameEnding            string           `json:"corporate_name_ending,omitempty"`
+	RecordType                     string           `json:"record_type"`
+	AlphaKey                       string           `json:"alpha_key"`
+	OrderedAlphaKey                string           `json:"ordered_alpha_key"`
+	DateOfCreation                 string           `json:"date_of_creation,omitempty"`
+	DateOfCessation                string           `json:"date_of_cessation,omitempty"`
+	RegisteredOfficeAddressSnippet string           `json:"registered_office_address_snippet,omitempty"`
+	SICCodes                       []string         `json:"sic_codes,omitempty"`
+	Jurisdiction                   string           `json:"jurisdiction,omitempty"`
+	PreviousCompanyNames           []EsPreviousName `json:"previous_company_names,omitempty"`
+}
+
+// EsPreviousName holds a name a company used to have, with its alpha keys and the dates it had it
+type EsPreviousName struct {
+	Name            string `json:"name"`
+	AlphaKey        string `json:"alpha_key"`
+	OrderedAlphaKey string `json:"ordered_alpha_key"`
+	EffectiveFrom   string `json:"effective_from,omitempty"`
+	CeasedOn        string `json:"ceased_on,omitempty"`
 }
 
 // EsLinks holds a set of links relevant to an EsCompany
@@ -1,21 +1,55 @@
 package datastructures
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
 // MongoLinks holds a set of links relevant to MongoData
 type MongoLinks struct {
 	Self string `bson:"self"`
 }
 
+// MongoAddress holds the parts of an address held in MongoDB
+type MongoAddress struct {
+	CareOf       string `bson:"care_of"`
+	POBox        string `bson:"po_box"`
+	Premises     string `bson:"premises"`
+	AddressLine1 string `bson:"address_line_1"`
+	AddressLine2 string `bson:"address_line_2"`
+	Locality     string `bson:"locality"`
+	Region       string `bson:"region"`
+	PostalCode   string `bson:"postal_code"`
+	Country      string `bson:"country"`
+}
+
+// MongoPreviousName holds a name a company used to have and the dates it had it
+type MongoPreviousName struct {
+	Name          string     `bson:"name"`
+	EffectiveFrom *time.Time `bson:"effective_from"`
+	CeasedOn      *time.Time `bson:"ceased_on"`
+}
+
 // MongoData contains company data from MongoDB
 type MongoData struct {
-	CompanyName   string     `bson:"company_name"`
-	CompanyNumber string     `bson:"company_number"`
-	CompanyStatus string     `bson:"company_status"`
-	CompanyType   string     `bson:"type"`
-	Links         MongoLinks `bson:"links"`
+	CompanyName             string              `bson:"company_name"`
+	CompanyNumber           string              `bson:"company_number"`
+	CompanyStatus           string              `bson:"company_status"`
+	CompanyType             string              `bson:"type"`
+	DateOfCreation          *time.Time          `bson:"date_of_creation"`
+	DateOfCessation         *time.Time          `bson:"date_of_cessation"`
+	RegisteredOfficeAddress *MongoAddress       `bson:"registered_office_address"`
+	SICCodes                []string            `bson:"sic_codes"`
+	Jurisdiction            string              `bson:"jurisdiction"`
+	PreviousCompanyNames    []MongoPreviousName `bson:"previous_company_names"`
+	Links                   MongoLinks          `bson:"links"`
 }
 
-// MongoCompany wraps MongoData with an accompanying ID
+// MongoCompany wraps MongoData with an accompanying ID, along with the whole document it was decoded from
+// when the loader has kept it
 type MongoCompany struct {
 	ID   string     `bson:"_id"`
 	Data *MongoData `bson:"data"`
+	Raw  bson.Raw   `bson:"-"`
 }
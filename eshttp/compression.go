@@ -0,0 +1,29 @@
+package eshttp
+
+import "sync/atomic"
+
+// CompressionStats accumulates the size of request bodies before and after compression. It is safe for
+// concurrent use.
+type CompressionStats struct {
+	raw        int64
+	compressed int64
+}
+
+// add records a body of raw bytes which compressed to compressed bytes
+func (s *CompressionStats) add(raw int, compressed int) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.raw, int64(raw))
+	atomic.AddInt64(&s.compressed, int64(compressed))
+}
+
+// Ratio returns how many times smaller request bodies have been made by compression, or 0 if none have
+// been compressed yet
+func (s *CompressionStats) Ratio() float64 {
+	compressed := atomic.LoadInt64(&s.compressed)
+	if compressed == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.raw)) / float64(compressed)
+}
@@ -0,0 +1,136 @@
+package eshttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RequesterConfig describes how a Requester made by NewRequesterWithConfig sends its requests
+type RequesterConfig struct {
+	Gzip        bool
+	Stats       *CompressionStats
+	Auth        Auth
+	TLS         TLS
+	Connections Connections
+	// Context aborts requests in flight, and any made afterwards, once it is done. Nil means never.
+	Context context.Context
+}
+
+// Connections bounds how long requests may take and how many connections are kept open between them.
+// Zero fields leave the defaults of http.DefaultTransport in place, which has no overall request timeout.
+type Connections struct {
+	// RequestTimeout covers the whole of a request, from dialling to reading the last of the response
+	RequestTimeout time.Duration
+	DialTimeout    time.Duration
+	// IdleTimeout is how long an unused connection is kept open for the next request
+	IdleTimeout    time.Duration
+	MaxIdlePerHost int
+}
+
+// Auth holds the credentials sent with every request. An API key takes precedence over a username and
+// password; with neither, requests are sent without credentials.
+type Auth struct {
+	Username string
+	Password string
+	// APIKey is the base64 encoded 'id:api_key' pair, as returned by Elastic Search when the key is created
+	APIKey string
+}
+
+// TLS describes how the servers requests are sent to are verified and how the client identifies itself.
+// Empty fields leave the defaults of the system in place.
+type TLS struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// NewRequesterWithConfig returns a concrete implementation of the Requester interface configured by config,
+// failing if the certificates it names cannot be loaded
+func NewRequesterWithConfig(config RequesterConfig) (Requester, error) {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	config.Connections.apply(transport)
+	if config.TLS != (TLS{}) {
+		tlsConfig, err := config.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &Request{
+		gzip:   config.Gzip,
+		stats:  config.Stats,
+		auth:   config.Auth,
+		client: &http.Client{Transport: transport, Timeout: config.Connections.RequestTimeout},
+		ctx:    ctx,
+	}, nil
+}
+
+// apply sets the dial and idle timeouts, and idle connection limit, of transport
+func (c Connections) apply(transport *http.Transport) {
+	if c.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: c.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if c.IdleTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleTimeout
+	}
+	if c.MaxIdlePerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdlePerHost
+		if transport.MaxIdleConns < c.MaxIdlePerHost {
+			transport.MaxIdleConns = c.MaxIdlePerHost
+		}
+	}
+}
+
+// config returns the tls.Config described by t
+func (t TLS) config() (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle [%s]: %s", t.CAFile, err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle [%s]", t.CAFile)
+		}
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("a client certificate and its key must be given together")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate [%s] and key [%s]: %s", t.CertFile, t.KeyFile, err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
+
+// authorize adds the credentials in a to r
+func (a Auth) authorize(r *http.Request) {
+	switch {
+	case a.APIKey != "":
+		r.Header.Set("Authorization", "ApiKey "+a.APIKey)
+	case a.Username != "":
+		r.SetBasicAuth(a.Username, a.Password)
+	}
+}
@@ -0,0 +1,146 @@
+package eshttp
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitNewRequesterWithConfig(t *testing.T) {
+
+	var authorization string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	caFile, err := ioutil.TempFile("", "ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile.Name())
+	_ = pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	_ = caFile.Close()
+
+	Convey("Given a requester trusting the server's CA and sending basic auth", t, func() {
+
+		r, err := NewRequesterWithConfig(RequesterConfig{
+			Auth: Auth{Username: "elastic", Password: "changeme"},
+			TLS:  TLS{CAFile: caFile.Name()},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Then requests should be accepted and carry the credentials", func() {
+
+			res, err := r.Do(http.MethodGet, nil, server.URL)
+			So(err, ShouldBeNil)
+			_ = res.Body.Close()
+			So(authorization, ShouldEqual, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ==")
+		})
+	})
+
+	Convey("Given a requester with an API key and verification disabled", t, func() {
+
+		r, err := NewRequesterWithConfig(RequesterConfig{
+			Auth: Auth{Username: "elastic", Password: "changeme", APIKey: "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+			TLS:  TLS{InsecureSkipVerify: true},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Then the API key should be sent in preference to the username and password", func() {
+
+			res, err := r.Post([]byte("{}"), server.URL)
+			So(err, ShouldBeNil)
+			_ = res.Body.Close()
+			So(authorization, ShouldEqual, "ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw==")
+		})
+	})
+
+	Convey("Given a requester which does not trust the server's CA", t, func() {
+
+		r, err := NewRequesterWithConfig(RequesterConfig{})
+		So(err, ShouldBeNil)
+
+		Convey("Then requests should be refused", func() {
+
+			_, err := r.Do(http.MethodGet, nil, server.URL)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Should fail when the CA bundle holds no certificates", t, func() {
+
+		_, err := NewRequesterWithConfig(RequesterConfig{TLS: TLS{CAFile: "config.go"}})
+		So(err.Error(), ShouldEqual, "no certificates found in CA bundle [config.go]")
+	})
+
+	Convey("Should fail when a client certificate is given without its key", t, func() {
+
+		_, err := NewRequesterWithConfig(RequesterConfig{TLS: TLS{CertFile: "client.pem"}})
+		So(err.Error(), ShouldEqual, "a client certificate and its key must be given together")
+	})
+}
+
+func TestUnitConnections(t *testing.T) {
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	Convey("Given a requester with a request timeout", t, func() {
+
+		r, err := NewRequesterWithConfig(RequesterConfig{Connections: Connections{RequestTimeout: 20 * time.Millisecond}})
+		So(err, ShouldBeNil)
+
+		Convey("Then a request which hangs should be abandoned", func() {
+
+			_, err := r.Do(http.MethodGet, nil, server.URL)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a client whose requests are made within a context", t, func() {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r, err := NewRequesterWithConfig(RequesterConfig{Context: ctx})
+		So(err, ShouldBeNil)
+
+		ctrl := gomock.NewController(t)
+		mw := write.NewMockWriter(ctrl)
+		mc := NewClientWithRetryPolicy(mw, r, RetryPolicy{MaxAttempts: 3})
+
+		Convey("When the context is cancelled while a request hangs", func() {
+
+			mw.EXPECT().LogPostError(gomock.Any())
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				cancel()
+			}()
+
+			_, err := mc.SubmitBulkToES([]byte("{}"), []byte("00006400"), server.URL, "companies")
+
+			Convey("Then the request should be aborted and not retried", func() {
+
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+				So(retryable(0, err), ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"strings"
 
 	"github.com/companieshouse/elasticsearch-data-loader/write"
 )
@@ -15,12 +17,32 @@ const applicationJSON = "application/json"
 type Client interface {
 	SubmitBulkToES(bulk []byte, companyNumbers []byte, esDestURL string, esDestIndex string) ([]byte, error)
 	GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error)
+	CreateIndex(esDestURL string, index string, scheme []byte) error
+	DeleteIndex(esDestURL string, index string) error
+	IndexExists(esDestURL string, index string) (bool, error)
+	GetSettings(esDestURL string, index string) (map[string]string, error)
+	PutSettings(esDestURL string, index string, settings []byte) error
+	ForceMerge(esDestURL string, index string, maxSegments int) error
+	Refresh(esDestURL string, index string) error
+	Count(esDestURL string, index string) (int, error)
+	GetAliasIndices(esDestURL string, alias string) ([]string, error)
+	GetIndices(esDestURL string, pattern string) ([]string, error)
+	UpdateAliases(esDestURL string, actions []byte) error
+	GetNodes(esDestURL string) ([]string, error)
 }
 
 // ClientImpl provides a concrete implementation of the Client interface
 type ClientImpl struct {
 	w write.Writer
 	r Requester
+	p RetryPolicy
+}
+
+// response holds the parts of an HTTP response used by the Client, the body having already been read
+type response struct {
+	status     string
+	statusCode int
+	body       []byte
 }
 
 // NewClient returns a concrete implementation of the Client interface
@@ -29,6 +51,7 @@ func NewClient(writer write.Writer) Client {
 	return &ClientImpl{
 		w: writer,
 		r: NewRequester(),
+		p: NoRetries,
 	}
 }
 
@@ -38,6 +61,18 @@ func NewClientWithRequester(writer write.Writer, requester Requester) Client {
 	return &ClientImpl{
 		w: writer,
 		r: requester,
+		p: NoRetries,
+	}
+}
+
+// NewClientWithRetryPolicy returns a concrete implementation of the Client interface, taking a custom Requester
+// and the RetryPolicy to apply to its requests
+func NewClientWithRetryPolicy(writer write.Writer, requester Requester, policy RetryPolicy) Client {
+
+	return &ClientImpl{
+		w: writer,
+		r: requester,
+		p: policy,
 	}
 }
 
@@ -46,50 +81,81 @@ func (c *ClientImpl) SubmitBulkToES(bulk []byte, companyNumbers []byte, esDestUR
 
 	uri := fmt.Sprintf("%s/%s/_bulk", esDestURL, esDestIndex)
 
-	r, err := c.r.Post(bulk, uri)
+	r, attempts, err := c.sendWithRetry(http.MethodPost, bulk, uri)
 	if err != nil {
-		c.w.LogPostError(string(companyNumbers))
-		log.Printf("error posting request %s: data %s", err, string(bulk))
+		c.w.LogPostError(withAttempts(string(companyNumbers), attempts))
+		log.Printf("error posting request %s after %d attempt(s): data %s", err, attempts, string(bulk))
 		return nil, err
 	}
 
-	defer func() {
-		err = r.Body.Close()
-		if err != nil {
-			log.Fatalf("failed to close response body after posting bulk to ES: %s", err)
-		}
-	}()
+	if r.statusCode > 299 {
+		c.w.LogUnexpectedResponse(withAttempts(string(companyNumbers), attempts))
+		log.Printf("unexpected put response %s after %d attempt(s): data %s", r.status, attempts, string(bulk))
+		return nil, errors.New("invalid response")
+	}
 
-	b, err := ioutil.ReadAll(r.Body)
+	return r.body, nil
+}
+
+// GetAlphaKeys performs a POST request to fetch alpha keys for a given set of company names
+func (c *ClientImpl) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+
+	uri := fmt.Sprintf("%s/alphakey-bulk", alphaKeyURL)
+
+	r, attempts, err := c.sendWithRetry(http.MethodPost, companyNames, uri)
 	if err != nil {
+		c.w.LogAlphaKeyErrors(withAttempts(string(companyNames), attempts))
+		log.Printf("error fetching alpha keys %s after %d attempt(s): data %s", err, attempts, string(companyNames))
 		return nil, err
 	}
 
-	if r.StatusCode > 299 {
-		c.w.LogUnexpectedResponse(string(companyNumbers))
-		log.Printf("unexpected put response %s: data %s", r.Status, string(bulk))
+	if r.statusCode > 299 {
+		c.w.LogAlphaKeyErrors(withAttempts(string(companyNames), attempts))
+		log.Printf("unexpected alpha key response %s after %d attempt(s): data %s", r.status, attempts, string(companyNames))
 		return nil, errors.New("invalid response")
 	}
 
-	return b, err
+	return r.body, nil
 }
 
-// GetAlphaKeys performs a POST request to fetch alpha keys for a given set of company names
-func (c *ClientImpl) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
+// sendWithRetry sends body to uri using the given method, retrying according to the Client's RetryPolicy,
+// and returns the final response along with the number of attempts made. A failed attempt may still have been
+// applied, so a resent bulk may find the documents it creates already exist.
+func (c *ClientImpl) sendWithRetry(method string, body []byte, uri string) (*response, int, error) {
+	for attempt := 1; ; attempt++ {
+		r, err := c.send(method, body, uri)
 
-	uri := fmt.Sprintf("%s/alphakey-bulk", alphaKeyURL)
+		statusCode := 0
+		if r != nil {
+			statusCode = r.statusCode
+		}
+		if !retryable(statusCode, err) || attempt >= c.p.MaxAttempts {
+			return r, attempt, err
+		}
+
+		d := c.p.Delay(attempt)
+		log.Printf("attempt %d of %d at %s %s failed, retrying in %s", attempt, c.p.MaxAttempts, method, uri, d)
+		sleep(d)
+	}
+}
 
-	r, err := c.r.Post(companyNames, uri)
+// send makes a single request, reading and closing the response body
+func (c *ClientImpl) send(method string, body []byte, uri string) (*response, error) {
+	var r *http.Response
+	var err error
+	if method == http.MethodPost {
+		r, err = c.r.Post(body, uri)
+	} else {
+		r, err = c.r.Do(method, body, uri)
+	}
 	if err != nil {
-		c.w.LogAlphaKeyErrors(string(companyNames))
-		log.Printf("error fetching alpha keys %s: data %s", err, string(companyNames))
 		return nil, err
 	}
 
 	defer func() {
 		err = r.Body.Close()
 		if err != nil {
-			log.Fatalf("failed to close response body after fetching alpha keys: %s", err)
+			log.Fatalf("failed to close response body after %s to %s: %s", method, uri, err)
 		}
 	}()
 
@@ -98,5 +164,10 @@ func (c *ClientImpl) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]by
 		return nil, err
 	}
 
-	return b, err
+	return &response{status: r.Status, statusCode: r.StatusCode, body: b}, nil
+}
+
+// withAttempts prefixes a message destined for the error logs with the number of attempts made
+func withAttempts(msg string, attempts int) string {
+	return fmt.Sprintf("attempts=%d %s", attempts, strings.TrimSpace(msg))
 }
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/companieshouse/elasticsearch-data-loader/write"
 	"github.com/golang/mock/gomock"
@@ -58,7 +59,7 @@ func TestUnitSubmitBulkToES(t *testing.T) {
 
 		Convey("Then the post error should be logged", func() {
 
-			mw.EXPECT().LogPostError(string(companyNumbers)).Times(1)
+			mw.EXPECT().LogPostError(withAttempts(string(companyNumbers), 1)).Times(1)
 
 			Convey(submitBulkToESCalled, func() {
 
@@ -83,7 +84,7 @@ func TestUnitSubmitBulkToES(t *testing.T) {
 
 		Convey("Then the unexpected response should be logged", func() {
 
-			mw.EXPECT().LogUnexpectedResponse(string(companyNumbers)).Times(1)
+			mw.EXPECT().LogUnexpectedResponse(withAttempts(string(companyNumbers), 1)).Times(1)
 
 			Convey(submitBulkToESCalled, func() {
 
@@ -141,7 +142,7 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 
 		Convey("Then the alpha ker error should be logged", func() {
 
-			mw.EXPECT().LogAlphaKeyErrors(string(companyNames)).Times(1)
+			mw.EXPECT().LogAlphaKeyErrors(withAttempts(string(companyNames), 1)).Times(1)
 
 			Convey("When GetAlphaKeys is called", func() {
 
@@ -161,6 +162,130 @@ func TestUnitGetAlphaKeys(t *testing.T) {
 	})
 }
 
+func TestUnitRetryPolicy(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mw := write.NewMockWriter(ctrl)
+	mr := NewMockRequester(ctrl)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	mc := NewClientWithRetryPolicy(mw, mr, policy)
+
+	bulk := []byte("bulk")
+	companyNumbers := []byte("\n00006400")
+	esDestURL := "esDestURL"
+	esDestIndex := "esDestIndex"
+	uri := esDestURL + "/" + esDestIndex + "/_bulk"
+
+	var delays []time.Duration
+	realSleep := sleep
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	defer func() { sleep = realSleep }()
+
+	Convey("Given Elastic Search responds with a 503 and then succeeds", t, func() {
+
+		delays = nil
+		gomock.InOrder(
+			mr.EXPECT().Post(bulk, uri).Return(constructResponse(503), nil),
+			mr.EXPECT().Post(bulk, uri).Return(constructSuccessResponse(), nil),
+		)
+
+		Convey(submitBulkToESCalled, func() {
+
+			returnedBytes, err := mc.SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex)
+
+			Convey("Then the bulk should be retried once after the base delay", func() {
+
+				So(returnedBytes, ShouldNotBeNil)
+				So(err, ShouldBeNil)
+				So(delays, ShouldResemble, []time.Duration{time.Second})
+			})
+		})
+	})
+
+	Convey("Given every attempt to post to Elastic Search fails", t, func() {
+
+		delays = nil
+		mr.EXPECT().Post(bulk, uri).Return(nil, errors.New("connection refused")).Times(3)
+
+		Convey("Then the post error should be logged with the number of attempts", func() {
+
+			mw.EXPECT().LogPostError("attempts=3 00006400").Times(1)
+
+			Convey(submitBulkToESCalled, func() {
+
+				returnedBytes, err := mc.SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex)
+
+				Convey(returnedBytesShouldBeNil, func() {
+
+					So(returnedBytes, ShouldBeNil)
+					So(err, ShouldNotBeNil)
+					So(delays, ShouldResemble, []time.Duration{time.Second, 2 * time.Second})
+				})
+			})
+		})
+	})
+
+	Convey("Given Elastic Search rejects the bulk with a 400", t, func() {
+
+		delays = nil
+		mr.EXPECT().Post(bulk, uri).Return(constructResponse(400), nil).Times(1)
+
+		Convey("Then the bulk should not be retried", func() {
+
+			mw.EXPECT().LogUnexpectedResponse("attempts=1 00006400").Times(1)
+
+			_, err := mc.SubmitBulkToES(bulk, companyNumbers, esDestURL, esDestIndex)
+
+			So(err, ShouldNotBeNil)
+			So(delays, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestUnitDelay(t *testing.T) {
+
+	Convey("Given a retry policy with jitter", t, func() {
+
+		policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 4 * time.Second, Jitter: 0.5}
+
+		Convey("When the random jitter is at its maximum", func() {
+
+			realRandom := random
+			random = func() float64 { return 1 }
+			defer func() { random = realRandom }()
+
+			Convey("Then the delay should grow exponentially and be capped before jitter is added", func() {
+
+				So(policy.Delay(1), ShouldEqual, 1500*time.Millisecond)
+				So(policy.Delay(2), ShouldEqual, 3*time.Second)
+				So(policy.Delay(5), ShouldEqual, 6*time.Second)
+			})
+		})
+
+		Convey("When the random jitter is at its minimum", func() {
+
+			realRandom := random
+			random = func() float64 { return 0 }
+			defer func() { random = realRandom }()
+
+			Convey("Then the delay should be reduced by the jitter fraction", func() {
+
+				So(policy.Delay(1), ShouldEqual, 500*time.Millisecond)
+			})
+		})
+	})
+}
+
+func constructResponse(statusCode int) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Body:       ioutil.NopCloser(bytes.NewBufferString(http.StatusText(statusCode))),
+		Header:     make(http.Header),
+	}
+}
+
 func constructSuccessResponse() *http.Response {
 
 	return &http.Response{
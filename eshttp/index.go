@@ -0,0 +1,196 @@
+package eshttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// CreateIndex creates an index using the given settings and mappings
+func (c *ClientImpl) CreateIndex(esDestURL string, index string, scheme []byte) error {
+
+	_, err := c.adminRequest(http.MethodPut, scheme, fmt.Sprintf("%s/%s", esDestURL, index))
+	return err
+}
+
+// IndexExists reports whether an index, or an alias, exists
+func (c *ClientImpl) IndexExists(esDestURL string, index string) (bool, error) {
+
+	uri := fmt.Sprintf("%s/%s", esDestURL, index)
+
+	r, _, err := c.sendWithRetry(http.MethodHead, nil, uri)
+	if err != nil {
+		return false, err
+	}
+
+	switch r.statusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, unexpectedResponse(http.MethodHead, uri, r)
+	}
+}
+
+// PutSettings updates the dynamic settings of an index
+func (c *ClientImpl) PutSettings(esDestURL string, index string, settings []byte) error {
+
+	_, err := c.adminRequest(http.MethodPut, settings, fmt.Sprintf("%s/%s/_settings", esDestURL, index))
+	return err
+}
+
+// GetSettings returns an index's settings, including defaults it has not overridden, keyed by their flattened
+// names such as 'index.refresh_interval'
+func (c *ClientImpl) GetSettings(esDestURL string, index string) (map[string]string, error) {
+
+	b, err := c.adminRequest(http.MethodGet, nil, fmt.Sprintf("%s/%s/_settings?flat_settings=true&include_defaults=true", esDestURL, index))
+	if err != nil {
+		return nil, err
+	}
+
+	var res map[string]struct {
+		Settings map[string]interface{} `json:"settings"`
+		Defaults map[string]interface{} `json:"defaults"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("error unmarshalling settings response [%s]: %s", b, err)
+	}
+
+	settings := make(map[string]string)
+	for _, r := range res {
+		for name, value := range r.Defaults {
+			settings[name] = fmt.Sprint(value)
+		}
+		for name, value := range r.Settings {
+			settings[name] = fmt.Sprint(value)
+		}
+	}
+	return settings, nil
+}
+
+// ForceMerge merges the segments of an index down to at most maxSegments
+func (c *ClientImpl) ForceMerge(esDestURL string, index string, maxSegments int) error {
+
+	_, err := c.adminRequest(http.MethodPost, nil, fmt.Sprintf("%s/%s/_forcemerge?max_num_segments=%d", esDestURL, index, maxSegments))
+	return err
+}
+
+// DeleteIndex deletes an index
+func (c *ClientImpl) DeleteIndex(esDestURL string, index string) error {
+
+	_, err := c.adminRequest(http.MethodDelete, nil, fmt.Sprintf("%s/%s", esDestURL, index))
+	return err
+}
+
+// Refresh makes everything written to an index visible to search
+func (c *ClientImpl) Refresh(esDestURL string, index string) error {
+
+	_, err := c.adminRequest(http.MethodPost, nil, fmt.Sprintf("%s/%s/_refresh", esDestURL, index))
+	return err
+}
+
+// Count returns the number of documents in an index
+func (c *ClientImpl) Count(esDestURL string, index string) (int, error) {
+
+	b, err := c.adminRequest(http.MethodGet, nil, fmt.Sprintf("%s/%s/_count", esDestURL, index))
+	if err != nil {
+		return 0, err
+	}
+
+	var res struct {
+		Count int `json:"count"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return 0, fmt.Errorf("error unmarshalling count response [%s]: %s", b, err)
+	}
+	return res.Count, nil
+}
+
+// GetAliasIndices returns the names of the indices an alias currently points at, if any
+func (c *ClientImpl) GetAliasIndices(esDestURL string, alias string) ([]string, error) {
+
+	uri := fmt.Sprintf("%s/_alias/%s", esDestURL, alias)
+
+	r, _, err := c.sendWithRetry(http.MethodGet, nil, uri)
+	if err != nil {
+		return nil, err
+	}
+	if r.statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if r.statusCode > 299 {
+		return nil, unexpectedResponse(http.MethodGet, uri, r)
+	}
+
+	var res map[string]json.RawMessage
+	if err := json.Unmarshal(r.body, &res); err != nil {
+		return nil, fmt.Errorf("error unmarshalling alias response [%s]: %s", r.body, err)
+	}
+
+	indices := make([]string, 0, len(res))
+	for index := range res {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// GetIndices returns the names of the indices matching a pattern, such as 'alpha_search-*', in name order
+func (c *ClientImpl) GetIndices(esDestURL string, pattern string) ([]string, error) {
+
+	b, err := c.adminRequest(http.MethodGet, nil, fmt.Sprintf("%s/_cat/indices/%s?format=json&h=index", esDestURL, pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	var res []struct {
+		Index string `json:"index"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("error unmarshalling indices response [%s]: %s", b, err)
+	}
+
+	indices := make([]string, 0, len(res))
+	for _, r := range res {
+		indices = append(indices, r.Index)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// UpdateAliases applies a set of alias actions, which Elastic Search performs atomically
+func (c *ClientImpl) UpdateAliases(esDestURL string, actions []byte) error {
+
+	_, err := c.adminRequest(http.MethodPost, actions, fmt.Sprintf("%s/_aliases", esDestURL))
+	return err
+}
+
+// adminRequest sends a request, returning the response body if Elastic Search accepted it, or an error
+// describing Elastic Search's response if not
+func (c *ClientImpl) adminRequest(method string, body []byte, uri string) ([]byte, error) {
+	r, _, err := c.sendWithRetry(method, body, uri)
+	if err != nil {
+		return nil, err
+	}
+	if r.statusCode > 299 {
+		return nil, unexpectedResponse(method, uri, r)
+	}
+	return r.body, nil
+}
+
+// unexpectedResponse returns an error describing a response Elastic Search should not have given, picking
+// out the type and reason of Elastic Search's error where the response holds one
+func unexpectedResponse(method string, uri string, r *response) error {
+	var res struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(r.body, &res); err == nil && res.Error.Type != "" {
+		return fmt.Errorf("%s %s: %s: %s: %s", method, uri, r.status, res.Error.Type, res.Error.Reason)
+	}
+	return fmt.Errorf("%s %s: %s: %s", method, uri, r.status, r.body)
+}
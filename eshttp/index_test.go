@@ -0,0 +1,193 @@
+package eshttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCreateIndex(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mw := write.NewMockWriter(ctrl)
+	mr := NewMockRequester(ctrl)
+	mc := NewClientWithRequester(mw, mr)
+
+	scheme := []byte(`{"mappings":{}}`)
+
+	Convey("Given Elastic Search accepts the index settings and mappings", t, func() {
+
+		mr.EXPECT().Do(http.MethodPut, scheme, "esDestURL/alpha_search-1").
+			Return(constructJSONResponse(200, `{"acknowledged":true}`), nil)
+
+		Convey("Then CreateIndex should not return an error", func() {
+
+			So(mc.CreateIndex("esDestURL", "alpha_search-1", scheme), ShouldBeNil)
+		})
+	})
+
+	Convey("Given Elastic Search rejects the mapping", t, func() {
+
+		mr.EXPECT().Do(http.MethodPut, scheme, "esDestURL/alpha_search-1").
+			Return(constructJSONResponse(400, `{"error":{"type":"mapper_parsing_exception"}}`), nil)
+
+		Convey("Then CreateIndex should return an error holding Elastic Search's response", func() {
+
+			err := mc.CreateIndex("esDestURL", "alpha_search-1", scheme)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "mapper_parsing_exception")
+		})
+	})
+
+	Convey("Given Elastic Search explains why it rejected the mapping", t, func() {
+
+		mr.EXPECT().Do(http.MethodPut, scheme, "esDestURL/alpha_search-1").
+			Return(constructJSONResponse(400, `{"error":{"root_cause":[],"type":"mapper_parsing_exception",`+
+				`"reason":"Failed to parse mapping [_doc]: unknown parameter [foo]"},"status":400}`), nil)
+
+		Convey("Then the error should give the type and reason alone", func() {
+
+			err := mc.CreateIndex("esDestURL", "alpha_search-1", scheme)
+
+			So(err.Error(), ShouldEqual, "PUT esDestURL/alpha_search-1: Bad Request: mapper_parsing_exception: "+
+				"Failed to parse mapping [_doc]: unknown parameter [foo]")
+		})
+	})
+}
+
+func TestUnitIndexExists(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mw := write.NewMockWriter(ctrl)
+	mr := NewMockRequester(ctrl)
+	mc := NewClientWithRequester(mw, mr)
+
+	Convey("Given the index exists", t, func() {
+
+		mr.EXPECT().Do(http.MethodHead, nil, "esDestURL/alpha_search").Return(constructJSONResponse(200, ""), nil)
+
+		exists, err := mc.IndexExists("esDestURL", "alpha_search")
+
+		So(exists, ShouldBeTrue)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Given the index does not exist", t, func() {
+
+		mr.EXPECT().Do(http.MethodHead, nil, "esDestURL/alpha_search").Return(constructJSONResponse(404, ""), nil)
+
+		exists, err := mc.IndexExists("esDestURL", "alpha_search")
+
+		So(exists, ShouldBeFalse)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestUnitAliasesAndCounts(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mw := write.NewMockWriter(ctrl)
+	mr := NewMockRequester(ctrl)
+	mc := NewClientWithRequester(mw, mr)
+
+	Convey("Given an alias which does not exist yet", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "esDestURL/_alias/alpha_search").
+			Return(constructJSONResponse(404, `{"error":"alias [alpha_search] missing","status":404}`), nil)
+
+		Convey("Then GetAliasIndices should return no indices", func() {
+
+			indices, err := mc.GetAliasIndices("esDestURL", "alpha_search")
+
+			So(err, ShouldBeNil)
+			So(indices, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an alias pointing at an index", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "esDestURL/_alias/alpha_search").
+			Return(constructJSONResponse(200, `{"alpha_search-1":{"aliases":{"alpha_search":{}}}}`), nil)
+
+		Convey("Then GetAliasIndices should return that index", func() {
+
+			indices, err := mc.GetAliasIndices("esDestURL", "alpha_search")
+
+			So(err, ShouldBeNil)
+			So(indices, ShouldResemble, []string{"alpha_search-1"})
+		})
+	})
+
+	Convey("Given several indices matching a pattern", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "esDestURL/_cat/indices/alpha_search-*?format=json&h=index").
+			Return(constructJSONResponse(200, `[{"index":"alpha_search-2"},{"index":"alpha_search-1"}]`), nil)
+
+		Convey("Then GetIndices should return them in name order", func() {
+
+			indices, err := mc.GetIndices("esDestURL", "alpha_search-*")
+
+			So(err, ShouldBeNil)
+			So(indices, ShouldResemble, []string{"alpha_search-1", "alpha_search-2"})
+		})
+	})
+
+	Convey("Given an index holding documents", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "esDestURL/alpha_search-1/_count").
+			Return(constructJSONResponse(200, `{"count":42,"_shards":{}}`), nil)
+
+		Convey("Then Count should return the number of documents", func() {
+
+			count, err := mc.Count("esDestURL", "alpha_search-1")
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 42)
+		})
+	})
+}
+
+func TestUnitGetSettings(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mw := write.NewMockWriter(ctrl)
+	mr := NewMockRequester(ctrl)
+	mc := NewClientWithRequester(mw, mr)
+
+	Convey("Given an index overriding some default settings", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "esDestURL/alpha_search/_settings?flat_settings=true&include_defaults=true").
+			Return(constructJSONResponse(200, `{"alpha_search-1":{`+
+				`"settings":{"index.number_of_replicas":"1","index.refresh_interval":"30s"},`+
+				`"defaults":{"index.refresh_interval":"1s","index.max_result_window":"10000"}}}`), nil)
+
+		Convey("Then GetSettings should return its own settings in preference to the defaults", func() {
+
+			settings, err := mc.GetSettings("esDestURL", "alpha_search")
+
+			So(err, ShouldBeNil)
+			So(settings["index.refresh_interval"], ShouldEqual, "30s")
+			So(settings["index.number_of_replicas"], ShouldEqual, "1")
+			So(settings["index.max_result_window"], ShouldEqual, "10000")
+		})
+	})
+}
+
+func constructJSONResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Header:     make(http.Header),
+	}
+}
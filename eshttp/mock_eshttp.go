@@ -33,6 +33,78 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// Count mocks base method.
+func (m *MockClient) Count(esDestURL, index string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", esDestURL, index)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockClientMockRecorder) Count(esDestURL, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockClient)(nil).Count), esDestURL, index)
+}
+
+// CreateIndex mocks base method.
+func (m *MockClient) CreateIndex(esDestURL, index string, scheme []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIndex", esDestURL, index, scheme)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateIndex indicates an expected call of CreateIndex.
+func (mr *MockClientMockRecorder) CreateIndex(esDestURL, index, scheme interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIndex", reflect.TypeOf((*MockClient)(nil).CreateIndex), esDestURL, index, scheme)
+}
+
+// DeleteIndex mocks base method.
+func (m *MockClient) DeleteIndex(esDestURL, index string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIndex", esDestURL, index)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIndex indicates an expected call of DeleteIndex.
+func (mr *MockClientMockRecorder) DeleteIndex(esDestURL, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIndex", reflect.TypeOf((*MockClient)(nil).DeleteIndex), esDestURL, index)
+}
+
+// ForceMerge mocks base method.
+func (m *MockClient) ForceMerge(esDestURL, index string, maxSegments int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForceMerge", esDestURL, index, maxSegments)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForceMerge indicates an expected call of ForceMerge.
+func (mr *MockClientMockRecorder) ForceMerge(esDestURL, index, maxSegments interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceMerge", reflect.TypeOf((*MockClient)(nil).ForceMerge), esDestURL, index, maxSegments)
+}
+
+// GetAliasIndices mocks base method.
+func (m *MockClient) GetAliasIndices(esDestURL, alias string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAliasIndices", esDestURL, alias)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAliasIndices indicates an expected call of GetAliasIndices.
+func (mr *MockClientMockRecorder) GetAliasIndices(esDestURL, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAliasIndices", reflect.TypeOf((*MockClient)(nil).GetAliasIndices), esDestURL, alias)
+}
+
 // GetAlphaKeys mocks base method.
 func (m *MockClient) GetAlphaKeys(companyNames []byte, alphaKeyURL string) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -48,6 +120,94 @@ func (mr *MockClientMockRecorder) GetAlphaKeys(companyNames, alphaKeyURL interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlphaKeys", reflect.TypeOf((*MockClient)(nil).GetAlphaKeys), companyNames, alphaKeyURL)
 }
 
+// GetIndices mocks base method.
+func (m *MockClient) GetIndices(esDestURL, pattern string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIndices", esDestURL, pattern)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIndices indicates an expected call of GetIndices.
+func (mr *MockClientMockRecorder) GetIndices(esDestURL, pattern interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIndices", reflect.TypeOf((*MockClient)(nil).GetIndices), esDestURL, pattern)
+}
+
+// GetNodes mocks base method.
+func (m *MockClient) GetNodes(esDestURL string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNodes", esDestURL)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNodes indicates an expected call of GetNodes.
+func (mr *MockClientMockRecorder) GetNodes(esDestURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodes", reflect.TypeOf((*MockClient)(nil).GetNodes), esDestURL)
+}
+
+// GetSettings mocks base method.
+func (m *MockClient) GetSettings(esDestURL, index string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSettings", esDestURL, index)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSettings indicates an expected call of GetSettings.
+func (mr *MockClientMockRecorder) GetSettings(esDestURL, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSettings", reflect.TypeOf((*MockClient)(nil).GetSettings), esDestURL, index)
+}
+
+// IndexExists mocks base method.
+func (m *MockClient) IndexExists(esDestURL, index string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IndexExists", esDestURL, index)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IndexExists indicates an expected call of IndexExists.
+func (mr *MockClientMockRecorder) IndexExists(esDestURL, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IndexExists", reflect.TypeOf((*MockClient)(nil).IndexExists), esDestURL, index)
+}
+
+// PutSettings mocks base method.
+func (m *MockClient) PutSettings(esDestURL, index string, settings []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutSettings", esDestURL, index, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutSettings indicates an expected call of PutSettings.
+func (mr *MockClientMockRecorder) PutSettings(esDestURL, index, settings interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutSettings", reflect.TypeOf((*MockClient)(nil).PutSettings), esDestURL, index, settings)
+}
+
+// Refresh mocks base method.
+func (m *MockClient) Refresh(esDestURL, index string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", esDestURL, index)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockClientMockRecorder) Refresh(esDestURL, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockClient)(nil).Refresh), esDestURL, index)
+}
+
 // SubmitBulkToES mocks base method.
 func (m *MockClient) SubmitBulkToES(bulk, companyNumbers []byte, esDestURL, esDestIndex string) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -62,3 +222,17 @@ func (mr *MockClientMockRecorder) SubmitBulkToES(bulk, companyNumbers, esDestURL
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubmitBulkToES", reflect.TypeOf((*MockClient)(nil).SubmitBulkToES), bulk, companyNumbers, esDestURL, esDestIndex)
 }
+
+// UpdateAliases mocks base method.
+func (m *MockClient) UpdateAliases(esDestURL string, actions []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateAliases", esDestURL, actions)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateAliases indicates an expected call of UpdateAliases.
+func (mr *MockClientMockRecorder) UpdateAliases(esDestURL, actions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateAliases", reflect.TypeOf((*MockClient)(nil).UpdateAliases), esDestURL, actions)
+}
@@ -0,0 +1,168 @@
+package eshttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoLiveNodes is returned by a NodePool while every node is cooling off after a connection error
+var ErrNoLiveNodes = errors.New("no live elasticsearch nodes")
+
+// NodePool provides an implementation of the Requester interface which spreads requests across several
+// Elastic Search nodes in turn. A node which cannot be reached is left alone for a cool-off period, its
+// requests failing over to the next live node.
+type NodePool struct {
+	mu        sync.Mutex
+	r         Requester
+	nodes     []string
+	coolOff   time.Duration
+	next      int
+	deadUntil map[string]time.Time
+}
+
+// NewNodePool returns a Requester which sends each request through requester to the next live node of
+// nodes, each a base URL such as 'https://es1:9200'. The node a request is addressed to is replaced by the
+// chosen node.
+func NewNodePool(requester Requester, nodes []string, coolOff time.Duration) Requester {
+
+	return &NodePool{
+		r:         requester,
+		nodes:     nodes,
+		coolOff:   coolOff,
+		deadUntil: make(map[string]time.Time),
+	}
+}
+
+// Post performs a POST request, using a provided body, against a given uri on the next live node
+func (p *NodePool) Post(body []byte, uri string) (*http.Response, error) {
+
+	return p.send(uri, func(uri string) (*http.Response, error) { return p.r.Post(body, uri) })
+}
+
+// Do performs a request using the given method, and body if not nil, against a given uri on the next live node
+func (p *NodePool) Do(method string, body []byte, uri string) (*http.Response, error) {
+
+	return p.send(uri, func(uri string) (*http.Response, error) { return p.r.Do(method, body, uri) })
+}
+
+// send makes the request on the next live node, failing over to each of the other live nodes in turn
+// should it fail to connect. A uri addressed to none of the pool's nodes is sent as it is.
+func (p *NodePool) send(uri string, request func(uri string) (*http.Response, error)) (*http.Response, error) {
+	path, ok := p.path(uri)
+	if !ok {
+		return request(uri)
+	}
+
+	var err error
+	for i := 0; i < len(p.nodes); i++ {
+		node, ok := p.pick()
+		if !ok {
+			break
+		}
+
+		var r *http.Response
+		if r, err = request(node + path); err == nil || errors.Is(err, context.Canceled) {
+			return r, err
+		}
+		p.markDead(node, err)
+	}
+
+	if err == nil {
+		err = ErrNoLiveNodes
+	}
+	return nil, err
+}
+
+// path returns uri without the node it is addressed to, or false if that is not one of the pool's nodes
+func (p *NodePool) path(uri string) (string, bool) {
+	for _, node := range p.nodes {
+		if strings.HasPrefix(uri, node) {
+			return strings.TrimPrefix(uri, node), true
+		}
+	}
+	return "", false
+}
+
+// pick returns the next live node in turn, or false if there is none
+func (p *NodePool) pick() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := now()
+	for i := 0; i < len(p.nodes); i++ {
+		node := p.nodes[p.next]
+		p.next = (p.next + 1) % len(p.nodes)
+		if !t.Before(p.deadUntil[node]) {
+			return node, true
+		}
+	}
+	return "", false
+}
+
+// markDead takes node out of rotation for the cool-off period
+func (p *NodePool) markDead(node string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deadUntil[node] = now().Add(p.coolOff)
+	log.Printf("elasticsearch node [%s] marked dead for %s: %s", node, p.coolOff, err)
+}
+
+// GetNodes asks the node at esDestURL for the HTTP addresses of every node in its cluster, returning them as
+// base URLs using the scheme of esDestURL. Nodes are addressed by the hostname they publish, if any, so that
+// their certificates can be verified; over https a node publishing only an IP address is left out.
+func (c *ClientImpl) GetNodes(esDestURL string) ([]string, error) {
+
+	b, err := c.adminRequest(http.MethodGet, nil, fmt.Sprintf("%s/_nodes/http", esDestURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Nodes map[string]struct {
+			HTTP struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("error unmarshalling nodes response [%s]: %s", b, err)
+	}
+
+	scheme := "http://"
+	if i := strings.Index(esDestURL, "://"); i >= 0 {
+		scheme = esDestURL[:i+3]
+	}
+
+	var nodes []string
+	for _, node := range res.Nodes {
+		address := node.HTTP.PublishAddress
+		if address == "" {
+			continue
+		}
+		// A publish address may be given as 'hostname/ip:port', or as just 'ip:port'.
+		if i := strings.Index(address, "/"); i > 0 {
+			hostname, ip := address[:i], address[i+1:]
+			address = hostname
+			if j := strings.LastIndex(ip, ":"); j >= 0 {
+				address += ip[j:]
+			}
+		} else if scheme == "https://" {
+			log.Printf("leaving out elasticsearch node at [%s], which publishes no hostname to verify its certificate against", address)
+			continue
+		} else {
+			address = strings.TrimPrefix(address, "/")
+		}
+		nodes = append(nodes, scheme+address)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
@@ -0,0 +1,143 @@
+package eshttp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitNodePool(t *testing.T) {
+
+	nodes := []string{"http://es1:9200", "http://es2:9200", "http://es3:9200"}
+	body := []byte("bulk")
+
+	var clock time.Time
+	realNow := now
+	now = func() time.Time { return clock }
+	defer func() { now = realNow }()
+
+	Convey("Given a pool of three nodes", t, func() {
+
+		clock = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+		ctrl := gomock.NewController(t)
+		mr := NewMockRequester(ctrl)
+		p := NewNodePool(mr, nodes, time.Minute)
+
+		Convey("Then requests should be sent to each node in turn", func() {
+
+			gomock.InOrder(
+				mr.EXPECT().Post(body, "http://es1:9200/companies/_bulk").Return(constructSuccessResponse(), nil),
+				mr.EXPECT().Post(body, "http://es2:9200/companies/_bulk").Return(constructSuccessResponse(), nil),
+				mr.EXPECT().Do(http.MethodGet, nil, "http://es3:9200/companies/_count").Return(constructSuccessResponse(), nil),
+				mr.EXPECT().Post(body, "http://es1:9200/companies/_bulk").Return(constructSuccessResponse(), nil),
+			)
+
+			for i := 0; i < 2; i++ {
+				_, err := p.Post(body, "http://es1:9200/companies/_bulk")
+				So(err, ShouldBeNil)
+			}
+			_, err := p.Do(http.MethodGet, nil, "http://es1:9200/companies/_count")
+			So(err, ShouldBeNil)
+			_, err = p.Post(body, "http://es1:9200/companies/_bulk")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("When a node cannot be reached", func() {
+
+			gomock.InOrder(
+				mr.EXPECT().Post(body, "http://es1:9200/_bulk").Return(nil, errors.New("connection refused")),
+				mr.EXPECT().Post(body, "http://es2:9200/_bulk").Return(constructSuccessResponse(), nil),
+			)
+
+			_, err := p.Post(body, "http://es1:9200/_bulk")
+
+			Convey("Then the request should fail over to the next node", func() {
+
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the node should be skipped until its cool-off has passed", func() {
+
+				gomock.InOrder(
+					mr.EXPECT().Post(body, "http://es3:9200/_bulk").Return(constructSuccessResponse(), nil),
+					mr.EXPECT().Post(body, "http://es2:9200/_bulk").Return(constructSuccessResponse(), nil),
+					mr.EXPECT().Post(body, "http://es3:9200/_bulk").Return(constructSuccessResponse(), nil),
+					mr.EXPECT().Post(body, "http://es1:9200/_bulk").Return(constructSuccessResponse(), nil),
+				)
+
+				_, _ = p.Post(body, "http://es1:9200/_bulk")
+				_, _ = p.Post(body, "http://es1:9200/_bulk")
+
+				clock = clock.Add(time.Minute)
+				_, _ = p.Post(body, "http://es1:9200/_bulk")
+				_, err := p.Post(body, "http://es1:9200/_bulk")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When no node can be reached", func() {
+
+			mr.EXPECT().Post(body, gomock.Any()).Return(nil, errors.New("connection refused")).Times(3)
+
+			_, err := p.Post(body, "http://es1:9200/_bulk")
+
+			Convey("Then the last connection error should be returned", func() {
+
+				So(err.Error(), ShouldEqual, "connection refused")
+			})
+
+			Convey("Then further requests should fail without being sent", func() {
+
+				_, err := p.Post(body, "http://es1:9200/_bulk")
+				So(err, ShouldEqual, ErrNoLiveNodes)
+			})
+		})
+	})
+}
+
+func TestUnitGetNodes(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mw := write.NewMockWriter(ctrl)
+	mr := NewMockRequester(ctrl)
+	mc := NewClientWithRequester(mw, mr)
+
+	Convey("Given a cluster of nodes publishing their HTTP addresses", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "https://es1:9200/_nodes/http").
+			Return(constructJSONResponse(200, `{"nodes":{`+
+				`"b":{"http":{"publish_address":"es2.internal/10.0.0.2:9200"}},`+
+				`"a":{"http":{"publish_address":"10.0.0.1:9200"}},`+
+				`"c":{}}}`), nil)
+
+		Convey("Then GetNodes should return the base URLs of those publishing a hostname, using the seed's scheme", func() {
+
+			nodes, err := mc.GetNodes("https://es1:9200")
+
+			So(err, ShouldBeNil)
+			So(nodes, ShouldResemble, []string{"https://es2.internal:9200"})
+		})
+	})
+
+	Convey("Given a cluster of nodes publishing their HTTP addresses over http", t, func() {
+
+		mr.EXPECT().Do(http.MethodGet, nil, "http://es1:9200/_nodes/http").
+			Return(constructJSONResponse(200, `{"nodes":{`+
+				`"b":{"http":{"publish_address":"es2.internal/10.0.0.2:9200"}},`+
+				`"a":{"http":{"publish_address":"10.0.0.1:9200"}}}}`), nil)
+
+		Convey("Then GetNodes should return their hostnames where published and their IP addresses otherwise", func() {
+
+			nodes, err := mc.GetNodes("http://es1:9200")
+
+			So(err, ShouldBeNil)
+			So(nodes, ShouldResemble, []string{"http://10.0.0.1:9200", "http://es2.internal:9200"})
+		})
+	})
+}
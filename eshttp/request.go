@@ -2,25 +2,87 @@ package eshttp
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
 	"net/http"
 )
 
 // Requester provides an interface by which to execute HTTP requests
 type Requester interface {
 	Post(body []byte, uri string) (*http.Response, error)
+	Do(method string, body []byte, uri string) (*http.Response, error)
 }
 
 // Request provides a concrete implementation of the Requester interface
-type Request struct{}
+type Request struct {
+	gzip   bool
+	stats  *CompressionStats
+	auth   Auth
+	client *http.Client
+	ctx    context.Context
+}
 
 // NewRequester returns a concrete implementation of the Requester interface
 func NewRequester() Requester {
 
-	return &Request{}
+	return &Request{client: http.DefaultClient, ctx: context.Background()}
+}
+
+// NewGzipRequester returns a concrete implementation of the Requester interface which gzips request bodies,
+// recording their size before and after compression in stats
+func NewGzipRequester(stats *CompressionStats) Requester {
+
+	return &Request{gzip: true, stats: stats, client: http.DefaultClient, ctx: context.Background()}
 }
 
 // Post performs a POST request, using a provided body, against a given uri
 func (req *Request) Post(body []byte, uri string) (*http.Response, error) {
 
-	return http.Post(uri, applicationJSON, bytes.NewReader(body))
+	return req.Do(http.MethodPost, body, uri)
+}
+
+// Do performs a request using the given method, and body if not nil, against a given uri. Compressed
+// responses are accepted, and transparently decompressed, by the http.Transport.
+func (req *Request) Do(method string, body []byte, uri string) (*http.Response, error) {
+
+	var reader io.Reader
+	if body != nil {
+		if req.gzip {
+			compressed, err := compress(body)
+			if err != nil {
+				return nil, err
+			}
+			req.stats.add(len(body), len(compressed))
+			body = compressed
+		}
+		reader = bytes.NewReader(body)
+	}
+
+	r, err := http.NewRequestWithContext(req.ctx, method, uri, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", applicationJSON)
+		if req.gzip {
+			r.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	req.auth.authorize(r)
+
+	return req.client.Do(r)
+}
+
+// compress returns body gzipped
+func compress(body []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
 }
@@ -0,0 +1,79 @@
+package eshttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGzipRequester(t *testing.T) {
+
+	body := bytes.Repeat([]byte(`{ "create": { "_id": "00006400" } }`+"\n"), 100)
+
+	var encoding string
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err == nil {
+			received, _ = ioutil.ReadAll(zr)
+		}
+
+		// Respond compressed to a client which accepts it.
+		if r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			_, _ = zw.Write([]byte(`{"errors":false}`))
+			_ = zw.Close()
+		}
+	}))
+	defer server.Close()
+
+	Convey("Given a requester gzipping request bodies", t, func() {
+
+		stats := &CompressionStats{}
+		r := NewGzipRequester(stats)
+
+		Convey("When a body is posted", func() {
+
+			res, err := r.Post(body, server.URL)
+			So(err, ShouldBeNil)
+			defer res.Body.Close()
+
+			Convey("Then it should be sent gzipped", func() {
+
+				So(encoding, ShouldEqual, "gzip")
+				So(received, ShouldResemble, body)
+			})
+
+			Convey("Then a compressed response should be decompressed", func() {
+
+				b, err := ioutil.ReadAll(res.Body)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, `{"errors":false}`)
+			})
+
+			Convey("Then the compression ratio should be recorded", func() {
+
+				So(stats.Ratio(), ShouldBeGreaterThan, 10)
+			})
+		})
+	})
+
+	Convey("Given a requester not compressing request bodies", t, func() {
+
+		res, err := NewRequester().Post(body, server.URL)
+		So(err, ShouldBeNil)
+		defer res.Body.Close()
+
+		Convey("Then the body should be sent as it is", func() {
+
+			So(encoding, ShouldBeEmpty)
+		})
+	})
+}
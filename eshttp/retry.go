@@ -0,0 +1,51 @@
+package eshttp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how often, and how far apart, failed requests are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// NoRetries is a RetryPolicy which makes a single attempt at each request
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+// Function variables to facilitate testing.
+var (
+	sleep  = time.Sleep
+	random = rand.Float64
+	now    = time.Now
+)
+
+// Delay returns how long to wait after the given (1-based) failed attempt. The delay doubles with each
+// attempt from BaseDelay up to MaxDelay, and is then moved up or down at random by up to Jitter of itself.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	d += d * p.Jitter * (2*random() - 1)
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// retryable reports whether a request which failed with err, or received statusCode, is worth trying again.
+// Connection errors, 429 Too Many Requests and 5xx responses are all expected to be transient, but a request
+// aborted by its context is not to be made again.
+func retryable(statusCode int, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	return err != nil || statusCode == 429 || statusCode >= 500
+}
@@ -3,10 +3,51 @@ package format
 import (
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 var nonWordEndRegex = regexp.MustCompile(`[^A-Za-z0-9_]+$`)
 
+// companyTypes maps the abbreviated and variant forms of company name endings to the company type they stand for.
+// Endings not listed are already in their usual form.
+var companyTypes = map[string]string{
+	"C.C.C":                       "CWMNI BUDDIANT CYMUNEDOL",
+	"C.I.C":                       "COMMUNITY INTEREST COMPANY",
+	"CCC":                         "CWMNI BUDDIANT CYMUNEDOL",
+	"CIC":                         "COMMUNITY INTEREST COMPANY",
+	"COMMUNITY INTEREST P.L.C":    "COMMUNITY INTEREST PUBLIC LIMITED COMPANY",
+	"COMMUNITY INTEREST PLC":      "COMMUNITY INTEREST PUBLIC LIMITED COMPANY",
+	"CWMNI BUDDIANT C.C.C":        "CWMNI BUDDIANT CYMUNEDOL",
+	"CWMNI BUDDIANT CCC":          "CWMNI BUDDIANT CYMUNEDOL",
+	"CYF":                         "CYFYNGEDIG",
+	"EEIG":                        "EUROPEAN ECONOMIC INTEREST GROUPING",
+	"ICVC":                        "INVESTMENT COMPANY WITH VARIABLE CAPITAL",
+	"L.P":                         "LIMITED PARTNERSHIP",
+	"L.T.D":                       "LIMITED",
+	"LIMITED - THE":               "LIMITED",
+	"LIMITED THE":                 "LIMITED",
+	"LIMITED-THE":                 "LIMITED",
+	"LIMITED...THE":               "LIMITED",
+	"LIMITED..THE":                "LIMITED",
+	"LIMITED.THE":                 "LIMITED",
+	"LLP":                         "LIMITED LIABILITY PARTNERSHIP",
+	"LP":                          "LIMITED PARTNERSHIP",
+	"LTD":                         "LIMITED",
+	"LTD...THE":                   "LIMITED",
+	"LTD..THE":                    "LIMITED",
+	"LTD.THE":                     "LIMITED",
+	"OEIC":                        "OPEN-ENDED INVESTMENT COMPANY",
+	"P.L.C":                       "PUBLIC LIMITED COMPANY",
+	"PCC":                         "PROTECTED CELL COMPANY",
+	"PCC LIMITED":                 "PROTECTED CELL COMPANY LIMITED",
+	"PCC LTD":                     "PROTECTED CELL COMPANY LIMITED",
+	"PLC":                         "PUBLIC LIMITED COMPANY",
+	"PUBLIC LIMITED COMPANY .THE": "PUBLIC LIMITED COMPANY",
+	"PUBLIC LIMITED COMPANY THE":  "PUBLIC LIMITED COMPANY",
+	"PUBLIC LIMITED COMPANY.THE":  "PUBLIC LIMITED COMPANY",
+	"UNLTD":                       "UNLIMITED",
+}
+
 var companyNameEndings = [...]string{
 	"AEIE",
 	"ANGHYFYNGEDIG",
@@ -84,6 +125,8 @@ var companyNameEndings = [...]string{
 // Formatter provides an interface by which to perform string formatting operations
 type Formatter interface {
 	SplitCompanyNameEndings(name string) (string, string)
+	StripCompanyName(name string) string
+	NormaliseCompanyType(nameEnding string) string
 }
 
 // Format provides a concrete implementation of the Formatter interface
@@ -116,3 +159,25 @@ func (f *Format) SplitCompanyNameEndings(name string) (string, string) {
 
 	return nameStart, nameEnding
 }
+
+// StripCompanyName returns name in capitals with everything but its letters and digits removed
+func (f *Format) StripCompanyName(name string) string {
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, name)
+}
+
+// NormaliseCompanyType returns the company type a name ending stands for, so that 'LTD' and 'LIMITED' both
+// become 'LIMITED'. An ending which is not recognised is returned in capitals without surrounding punctuation.
+func (f *Format) NormaliseCompanyType(nameEnding string) string {
+
+	ending := strings.ToUpper(strings.TrimSpace(nonWordEndRegex.ReplaceAllString(nameEnding, "")))
+	if companyType, ok := companyTypes[ending]; ok {
+		return companyType
+	}
+	return ending
+}
@@ -30,3 +30,34 @@ func TestUnitSplitCompanyNameEndings(t *testing.T) {
 		})
 	})
 }
+
+func TestUnitStripCompanyName(t *testing.T) {
+
+	f := NewFormatter()
+
+	Convey("Should keep only the letters and digits of a name, in capitals", t, func() {
+
+		So(f.StripCompanyName("A & B (Holdings) 2"), ShouldEqual, "ABHOLDINGS2")
+		So(f.StripCompanyName("Café-Bar"), ShouldEqual, "CAFÉBAR")
+		So(f.StripCompanyName("!!!"), ShouldEqual, "")
+	})
+}
+
+func TestUnitNormaliseCompanyType(t *testing.T) {
+
+	f := NewFormatter()
+
+	Convey("Should replace abbreviated and variant endings with the company type", t, func() {
+
+		So(f.NormaliseCompanyType(" LTD."), ShouldEqual, "LIMITED")
+		So(f.NormaliseCompanyType(" LIMITED.THE"), ShouldEqual, "LIMITED")
+		So(f.NormaliseCompanyType(" P.L.C."), ShouldEqual, "PUBLIC LIMITED COMPANY")
+		So(f.NormaliseCompanyType(" LLP"), ShouldEqual, "LIMITED LIABILITY PARTNERSHIP")
+	})
+
+	Convey("Should return other endings in capitals", t, func() {
+
+		So(f.NormaliseCompanyType(" Limited"), ShouldEqual, "LIMITED")
+		So(f.NormaliseCompanyType(" CYFYNGEDIG"), ShouldEqual, "CYFYNGEDIG")
+	})
+}
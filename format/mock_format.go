@@ -33,6 +33,20 @@ func (m *MockFormatter) EXPECT() *MockFormatterMockRecorder {
 	return m.recorder
 }
 
+// NormaliseCompanyType mocks base method
+func (m *MockFormatter) NormaliseCompanyType(arg0 string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NormaliseCompanyType", arg0)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// NormaliseCompanyType indicates an expected call of NormaliseCompanyType
+func (mr *MockFormatterMockRecorder) NormaliseCompanyType(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NormaliseCompanyType", reflect.TypeOf((*MockFormatter)(nil).NormaliseCompanyType), arg0)
+}
+
 // SplitCompanyNameEndings mocks base method
 func (m *MockFormatter) SplitCompanyNameEndings(arg0 string) (string, string) {
 	m.ctrl.T.Helper()
@@ -47,3 +61,17 @@ func (mr *MockFormatterMockRecorder) SplitCompanyNameEndings(arg0 interface{}) *
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SplitCompanyNameEndings", reflect.TypeOf((*MockFormatter)(nil).SplitCompanyNameEndings), arg0)
 }
+
+// StripCompanyName mocks base method
+func (m *MockFormatter) StripCompanyName(arg0 string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StripCompanyName", arg0)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// StripCompanyName indicates an expected call of StripCompanyName
+func (mr *MockFormatterMockRecorder) StripCompanyName(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StripCompanyName", reflect.TypeOf((*MockFormatter)(nil).StripCompanyName), arg0)
+}
@@ -38,7 +38,7 @@ do
       echo "Options are:"
       echo ""
       echo "      OPTION    ENV-VAR        DESCRIPTION                              EXAMPLE ('' does NOT indicate default value)"
-      echo "        -s      search         The search type you intend to write to.  officer or disqualified-officer or company"
+      echo "        -s      search         The search type you intend to write to.  company or officer"
       echo "        -e      es_url         The elastic search url.                  chs-pp-es1.ch.gov.uk:9200"
       echo "        -i      index          The name of the elastic search index.    test-company"
       echo "        -m      mongo_url      The mongo db url.                        chs-pp-mes-sl2.ch.gov.uk:27019"
@@ -60,6 +60,7 @@ index=${index:?ERROR: var not set [-i index]}
 es_url=${es_url:?ERROR: var not set [-e es_url]}
 mongo_url=${mongo_url:?ERROR: var not set [-m mongo_url]}
 alphakey_url=${alphakey_url:?ERROR: var not set [-a alphakey_url]}
+create_mapping=${create_mapping:-false}
 
 full_es_url="$es_url/"$index
 echo "            search: $search"
@@ -70,37 +71,28 @@ echo " mongo db password: $password"
 echo "      alphakey url: $alphakey_url"
 
 # Check load type
+bindex="./companybindex/companybindex"
 if [ $search = "company" ]
 then
-    bindex="./companybindex/companybindex"
     scheme="search_scheme.json"
+    type="alpha_search"
+elif [ $search = "officer" ]
+then
+    scheme="officer_search_scheme.json"
+    type="officer"
 else
-    echo "Incorrect search - use company"
+    echo "Incorrect search - use company or officer"
     echo "Use -h for further options"
     exit 1
 fi
 
 echo "-----------------------------------"
-echo "STEP 1: Delete existing index if -c flag set to true"
-if [ $create_mapping = "true" ]
-then
-    echo "DELETING INDEX $full_es_url"
-    delete_index="curl -XDELETE $full_es_url"
-    echo $delete_index
-    delete_index_response=`$delete_index`
-    echo $delete_index_response
-else
-    echo "NOT DELETING INDEX"
-fi
-
-echo "-----------------------------------"
-echo "STEP 2: Create index with new mapping if -c flag set to true"
-if [ $create_mapping = "true" ]
+echo "STEPS 1 & 2: Delete existing index and create it with new mapping if -c flag set to true"
+if [ "$create_mapping" = "true" ]
 then
-    echo "CREATING INDEX WITH NEW MAPPING $full_es_url"
-    curl -XPUT -H "Content-Type: application/json" $full_es_url -d@./config/$scheme
+    echo "INDEX $full_es_url WILL BE RECREATED FROM ./config/$scheme BY $bindex"
 else
-    echo "NOT CREATING INDEX WITH NEW MAPPING"
+    echo "NOT DELETING INDEX OR CREATING INDEX WITH NEW MAPPING"
 fi
 
 # Check for authentication fields and build full mongo url
@@ -127,7 +119,7 @@ fi
 echo "bindex: $bindex"
 
 echo "-----------------------------------"
-echo "STEP 3: Start $type load"
-upload="$bindex -mongo-url=$full_mongo_url -es-dest-url=$es_url -es-dest-type=alpha_search -alphakey-url=$alphakey_url -es-dest-index=$index"
+echo "STEP 3: Start $search load"
+upload="$bindex -type=$search -mongo-url=$full_mongo_url -es-dest-url=$es_url -es-dest-type=$type -alphakey-url=$alphakey_url -es-dest-index=$index -delete-index=$create_mapping -create-index=$create_mapping -index-scheme=./config/$scheme"
 echo $upload
 exec $upload
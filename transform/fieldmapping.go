@@ -0,0 +1,239 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+)
+
+var readFile = ioutil.ReadFile
+
+// Mapping describes how the fields of an Elasticsearch document are built from a MongoDB document
+type Mapping struct {
+	// ID is the path of the document's ID in the MongoDB document
+	ID string `json:"id"`
+	// Name is the path of the company name whose alpha keys are fetched
+	Name string `json:"name"`
+	// PreviousNames is the path of the array of previous names whose alpha keys are fetched, if any
+	PreviousNames string  `json:"previous_names,omitempty"`
+	Fields        []Field `json:"fields"`
+}
+
+// Field describes how a single field of an Elasticsearch document is built. The value at Source, if any, is
+// passed through each of the Functions in turn, replaced by its entry in Values, if any, and formatted with
+// Format, if set. Default is used in place of an empty result.
+type Field struct {
+	Target    string                 `json:"target"`
+	Source    string                 `json:"source,omitempty"`
+	Functions []string               `json:"functions,omitempty"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+	Format    string                 `json:"format,omitempty"`
+	Default   interface{}            `json:"default,omitempty"`
+	Required  bool                   `json:"required,omitempty"`
+	OmitEmpty bool                   `json:"omitempty,omitempty"`
+}
+
+// fieldContext holds what the functions of a Field may need besides the value they are passed
+type fieldContext struct {
+	id                string
+	alphaKey          *datastructures.AlphaKey
+	previousAlphaKeys []datastructures.AlphaKey
+	f                 format.Formatter
+}
+
+// fieldFunction is a function which a Field may apply to its value
+type fieldFunction func(value interface{}, c *fieldContext) interface{}
+
+// fieldFunctions holds the functions a Field may apply to its value, by name
+var fieldFunctions = map[string]fieldFunction{
+	"uppercase": stringFunction(strings.ToUpper),
+	"lowercase": stringFunction(strings.ToLower),
+	"trim":      stringFunction(strings.TrimSpace),
+	"name_start": func(value interface{}, c *fieldContext) interface{} {
+		start, _ := c.f.SplitCompanyNameEndings(toString(value))
+		return start
+	},
+	"name_ending": func(value interface{}, c *fieldContext) interface{} {
+		_, ending := c.f.SplitCompanyNameEndings(toString(value))
+		return ending
+	},
+	"strip": func(value interface{}, c *fieldContext) interface{} {
+		return c.f.StripCompanyName(toString(value))
+	},
+	"company_type": func(value interface{}, c *fieldContext) interface{} {
+		return c.f.NormaliseCompanyType(toString(value))
+	},
+	"with_company_type": func(value interface{}, c *fieldContext) interface{} {
+		start, ending := c.f.SplitCompanyNameEndings(toString(value))
+		if ending == "" {
+			return start
+		}
+		return start + " " + c.f.NormaliseCompanyType(ending)
+	},
+	"alpha_key": func(value interface{}, c *fieldContext) interface{} {
+		return c.alphaKey.SameAsAlphaKey
+	},
+	"ordered_alpha_key": func(value interface{}, c *fieldContext) interface{} {
+		return c.alphaKey.OrderedAlphaKey
+	},
+	"with_id": func(value interface{}, c *fieldContext) interface{} {
+		return toString(value) + ":" + c.id
+	},
+	"length": func(value interface{}, c *fieldContext) interface{} {
+		return utf8.RuneCountInString(toString(value))
+	},
+	"date": func(value interface{}, c *fieldContext) interface{} {
+		if date, ok := value.(time.Time); ok {
+			return formatDate(&date)
+		}
+		return value
+	},
+	"address_snippet": func(value interface{}, c *fieldContext) interface{} {
+		address, _ := value.(map[string]interface{})
+		if address == nil {
+			return nil
+		}
+		return addressSnippet(&datastructures.MongoAddress{
+			CareOf:       toString(address["care_of"]),
+			POBox:        toString(address["po_box"]),
+			Premises:     toString(address["premises"]),
+			AddressLine1: toString(address["address_line_1"]),
+			AddressLine2: toString(address["address_line_2"]),
+			Locality:     toString(address["locality"]),
+			Region:       toString(address["region"]),
+			PostalCode:   toString(address["postal_code"]),
+			Country:      toString(address["country"]),
+		})
+	},
+	"previous_names": func(value interface{}, c *fieldContext) interface{} {
+		entries, _ := value.([]interface{})
+		names := make([]datastructures.MongoPreviousName, len(entries))
+		for i, entry := range entries {
+			name, _ := entry.(map[string]interface{})
+			names[i] = datastructures.MongoPreviousName{
+				Name:          toString(name["name"]),
+				EffectiveFrom: toTime(name["effective_from"]),
+				CeasedOn:      toTime(name["ceased_on"]),
+			}
+		}
+		if previous := previousNames(names, c.previousAlphaKeys); previous != nil {
+			return previous
+		}
+		return nil
+	},
+}
+
+// sourceFunctions are the functions which provide a value of their own, so need no Source
+var sourceFunctions = map[string]bool{
+	"alpha_key":         true,
+	"ordered_alpha_key": true,
+}
+
+// LoadMapping reads and validates the Mapping held in a JSON file
+func LoadMapping(path string) (*Mapping, error) {
+
+	b, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMapping(b)
+}
+
+// ParseMapping decodes and validates a Mapping held as JSON, rejecting any attribute it does not recognise
+func ParseMapping(b []byte) (*Mapping, error) {
+
+	var m Mapping
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&m); err != nil {
+		return nil, fmt.Errorf("error decoding field mapping: %s", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate returns an error describing the first problem found with the Mapping, or nil if there is none
+func (m *Mapping) Validate() error {
+
+	if m.ID == "" {
+		return errors.New("field mapping has no id path")
+	}
+	if m.Name == "" {
+		return errors.New("field mapping has no name path")
+	}
+	if len(m.Fields) == 0 {
+		return errors.New("field mapping has no fields")
+	}
+
+	targets := make(map[string]bool)
+	for i, field := range m.Fields {
+		if field.Target == "" {
+			return fmt.Errorf("field %d has no target", i)
+		}
+		if targets[field.Target] {
+			return fmt.Errorf("field [%s] is mapped more than once", field.Target)
+		}
+		targets[field.Target] = true
+
+		for _, name := range field.Functions {
+			if _, ok := fieldFunctions[name]; !ok {
+				return fmt.Errorf("field [%s] uses unknown function [%s]", field.Target, name)
+			}
+			// The alpha keys of previous names are fetched from the mapping's previous names path alone.
+			if name == "previous_names" && (m.PreviousNames == "" || field.Source != m.PreviousNames) {
+				return fmt.Errorf("field [%s] uses previous_names on [%s], not the mapping's previous names path [%s]",
+					field.Target, field.Source, m.PreviousNames)
+			}
+		}
+		if field.Source == "" && field.Default == nil && (len(field.Functions) == 0 || !sourceFunctions[field.Functions[0]]) {
+			return fmt.Errorf("field [%s] has no source, default or alpha key function", field.Target)
+		}
+	}
+
+	// A target cannot hold a value and other fields at once.
+	for target := range targets {
+		for parent := target; strings.Contains(parent, "."); {
+			parent = parent[:strings.LastIndex(parent, ".")]
+			if targets[parent] {
+				return fmt.Errorf("field [%s] is mapped inside field [%s]", target, parent)
+			}
+		}
+	}
+	return nil
+}
+
+// stringFunction returns a fieldFunction applying fn to its value as a string
+func stringFunction(fn func(string) string) fieldFunction {
+	return func(value interface{}, c *fieldContext) interface{} {
+		return fn(toString(value))
+	}
+}
+
+// toTime returns value as a time, or nil if it is not one
+func toTime(value interface{}) *time.Time {
+	if t, ok := value.(time.Time); ok {
+		return &t
+	}
+	return nil
+}
+
+// toString returns value as a string, or an empty string if there is no value
+func toString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,48 @@
+package transform
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitParseMapping(t *testing.T) {
+
+	Convey("Should accept the field mapping shipped with the loader", t, func() {
+
+		m, err := LoadMapping(companyMapping)
+
+		So(err, ShouldBeNil)
+		So(m.ID, ShouldEqual, "_id")
+		So(m.Name, ShouldEqual, "data.company_name")
+	})
+
+	Convey("Should reject field mappings which cannot be applied", t, func() {
+
+		for mapping, reason := range map[string]string{
+			`{"id":"_id","name":"n","fields":[{"target":"a","source":"a","colour":"red"}]}`:                  `unknown field "colour"`,
+			`{"name":"n","fields":[{"target":"a","source":"a"}]}`:                                            "no id path",
+			`{"id":"_id","fields":[{"target":"a","source":"a"}]}`:                                            "no name path",
+			`{"id":"_id","name":"n","fields":[]}`:                                                            "no fields",
+			`{"id":"_id","name":"n","fields":[{"source":"a"}]}`:                                              "field 0 has no target",
+			`{"id":"_id","name":"n","fields":[{"target":"a","source":"a"},{"target":"a","source":"b"}]}`:     "[a] is mapped more than once",
+			`{"id":"_id","name":"n","fields":[{"target":"a","source":"a","functions":["reverse"]}]}`:         "unknown function [reverse]",
+			`{"id":"_id","name":"n","fields":[{"target":"a","functions":["uppercase"]}]}`:                    "no source, default or alpha key function",
+			`{"id":"_id","name":"n","fields":[{"target":"a","source":"a"},{"target":"a.b.c","source":"b"}]}`: "[a.b.c] is mapped inside field [a]",
+			`{"id":"_id","name":"n","fields":[{"target":"a","source":"p","functions":["previous_names"]}]}`:  "not the mapping's previous names path []",
+		} {
+			_, err := ParseMapping([]byte(mapping))
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, reason)
+		}
+	})
+
+	Convey("Should accept fields taking their value from an alpha key or a default", t, func() {
+
+		_, err := ParseMapping([]byte(`{"id":"_id","name":"n","fields":[` +
+			`{"target":"a","functions":["alpha_key","with_id"]},{"target":"b","default":0}]}`))
+
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,201 @@
+package transform
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Mapped provides an implementation of the Transformer interface which builds documents as described by a
+// Mapping, from the whole of each MongoDB document
+type Mapped struct {
+	w write.Writer
+	f format.Formatter
+	m *Mapping
+}
+
+// NewMappedTransformer returns an implementation of the Transformer interface building documents as described
+// by mapping. The alpha keys of previous names are fetched only if mapping gives a previous names path.
+func NewMappedTransformer(writer write.Writer, formatter format.Formatter, mapping *Mapping) Transformer {
+
+	return &Mapped{
+		w: writer,
+		f: formatter,
+		m: mapping,
+	}
+}
+
+// TransformMongoCompanyToEsCompany builds the document of a MongoCompany as described by the Mapping, returning
+// nil if a required field is empty. The alpha keys of previous names are taken in the order they are held.
+func (t *Mapped) TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey, previousAlphaKeys []datastructures.AlphaKey) *datastructures.EsCompany {
+
+	if mongoCompany.Raw == nil {
+		t.w.LogMissingCompanyData(fmt.Sprintf("Missing company data element for company ID %s", mongoCompany.ID))
+		return nil
+	}
+
+	id := toString(lookup(mongoCompany.Raw, t.m.ID))
+	c := &fieldContext{id: id, alphaKey: alphaKey, previousAlphaKeys: previousAlphaKeys, f: t.f}
+
+	doc := make(map[string]interface{})
+	for _, field := range t.m.Fields {
+		value := t.value(mongoCompany.Raw, field, c)
+
+		if empty(value) {
+			switch {
+			case field.Required && field.Source == t.m.Name:
+				t.w.LogMissingCompanyName(id)
+				return nil
+			case field.Required:
+				t.w.LogMissingCompanyData(fmt.Sprintf("Missing %s for company ID %s", field.Source, id))
+				return nil
+			case field.OmitEmpty:
+				continue
+			}
+		}
+		set(doc, field.Target, value)
+	}
+
+	return &datastructures.EsCompany{ID: id, Document: doc}
+}
+
+// GetCompanyNames returns the names found at the Mapping's name path of a given set of 'MongoCompany's,
+// followed by those at its previous names path, if any, in the same order as the built in Transformer
+func (t *Mapped) GetCompanyNames(companies *[]*datastructures.MongoCompany, length int) []datastructures.CompanyName {
+
+	var companyNames []datastructures.CompanyName
+	for i := 0; i < length; i++ {
+		mongoCompany := (*companies)[i]
+		switch {
+		case mongoCompany == nil:
+			log.Printf("Missing company element")
+			companyNames = appendCompanyNamesSpacer(companyNames)
+		case mongoCompany.Raw == nil:
+			companyNames = appendCompanyNamesSpacer(companyNames)
+		default:
+			companyNames = append(companyNames, datastructures.CompanyName{Name: toString(lookup(mongoCompany.Raw, t.m.Name))})
+		}
+	}
+
+	for i := 0; i < length; i++ {
+		for _, previous := range t.previousNames((*companies)[i]) {
+			name, _ := previous.(map[string]interface{})
+			companyNames = append(companyNames, datastructures.CompanyName{Name: toString(name["name"])})
+		}
+	}
+
+	return companyNames
+}
+
+// PreviousNameCount returns the number of previous names of a MongoCompany whose alpha keys are fetched along
+// with its name
+func (t *Mapped) PreviousNameCount(mongoCompany *datastructures.MongoCompany) int {
+
+	return len(t.previousNames(mongoCompany))
+}
+
+// previousNames returns the entries at the Mapping's previous names path of a MongoCompany, if any
+func (t *Mapped) previousNames(mongoCompany *datastructures.MongoCompany) []interface{} {
+	if t.m.PreviousNames == "" || mongoCompany == nil || mongoCompany.Raw == nil {
+		return nil
+	}
+	previous, _ := lookup(mongoCompany.Raw, t.m.PreviousNames).([]interface{})
+	return previous
+}
+
+// value returns the value of a field built from a MongoDB document
+func (t *Mapped) value(raw bson.Raw, field Field, c *fieldContext) interface{} {
+	var value interface{}
+	if field.Source != "" {
+		value = lookup(raw, field.Source)
+	}
+
+	for _, name := range field.Functions {
+		value = fieldFunctions[name](value, c)
+	}
+
+	if field.Values != nil {
+		value = field.Values[toString(value)]
+	}
+
+	if field.Format != "" && !empty(value) {
+		value = fmt.Sprintf(field.Format, value)
+	}
+
+	if empty(value) && field.Default != nil {
+		value = field.Default
+	}
+	return value
+}
+
+// lookup returns the value at a dotted path in a MongoDB document, or nil if there is none
+func lookup(raw bson.Raw, path string) interface{} {
+	v, err := raw.LookupErr(strings.Split(path, ".")...)
+	if err != nil {
+		return nil
+	}
+	return rawValue(v)
+}
+
+// rawValue returns a BSON value as the Go value it is indexed as
+func rawValue(v bson.RawValue) interface{} {
+	switch v.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return nil
+	case bsontype.Array:
+		values, _ := v.Array().Values()
+		array := make([]interface{}, len(values))
+		for i, value := range values {
+			array[i] = rawValue(value)
+		}
+		return array
+	case bsontype.EmbeddedDocument:
+		elements, _ := v.Document().Elements()
+		doc := make(map[string]interface{}, len(elements))
+		for _, element := range elements {
+			doc[element.Key()] = rawValue(element.Value())
+		}
+		return doc
+	case bsontype.DateTime:
+		return v.Time().UTC()
+	}
+
+	var value interface{}
+	if err := v.Unmarshal(&value); err != nil {
+		return v.String()
+	}
+	return value
+}
+
+// empty reports whether a value is missing, an empty string or an empty array
+func empty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// set sets the value at a dotted path in a document, adding the objects on the way as needed
+func set(doc map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := doc[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			doc[part] = child
+		}
+		doc = child
+	}
+	doc[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,227 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	"github.com/companieshouse/elasticsearch-data-loader/format"
+	"github.com/companieshouse/elasticsearch-data-loader/write"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const companyMapping = "../config/company_mapping.json"
+
+// decodeCompany returns a MongoCompany decoded from doc as it would be read from MongoDB
+func decodeCompany(doc bson.M) *datastructures.MongoCompany {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	var c datastructures.MongoCompany
+	if err := bson.Unmarshal(b, &c); err != nil {
+		panic(err)
+	}
+	c.Raw = b
+	return &c
+}
+
+func TestUnitMappedTransformer(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	mw := write.NewMockWriter(ctrl)
+
+	Convey("Given a mapping of uppercased, defaulted, looked up and formatted fields", t, func() {
+
+		m, err := ParseMapping([]byte(`{"id":"_id","name":"data.name","fields":[
+			{"target":"name.upper","source":"data.name","functions":["trim","uppercase"],"required":true},
+			{"target":"name.key","functions":["ordered_alpha_key","with_id"]},
+			{"target":"status","source":"data.status","values":{"active":"live"},"default":"gone"},
+			{"target":"link","source":"_id","format":"/company/%s"},
+			{"target":"created","source":"data.created","functions":["date"]},
+			{"target":"codes","source":"data.codes","omitempty":true},
+			{"target":"region","source":"data.address.region","omitempty":true}
+		]}`))
+		So(err, ShouldBeNil)
+		tr := NewMappedTransformer(mw, format.NewFormatter(), m)
+
+		company := decodeCompany(bson.M{"_id": "00006400", "data": bson.M{
+			"name":    " Acme Ltd ",
+			"status":  "active",
+			"created": time.Date(1890, time.March, 4, 0, 0, 0, 0, time.UTC),
+			"codes":   bson.A{"62012"},
+		}})
+		ak := datastructures.AlphaKey{OrderedAlphaKey: "ACMELTD"}
+
+		Convey(callTransformMongoCompanyToEsCompany, func() {
+
+			esData := tr.TransformMongoCompanyToEsCompany(company, &ak, nil)
+			doc, err := json.Marshal(esData)
+
+			Convey("Then the document should be built as the mapping describes", func() {
+
+				So(err, ShouldBeNil)
+				So(esData.ID, ShouldEqual, "00006400")
+				So(string(doc), ShouldEqual, `{"codes":["62012"],"created":"1890-03-04","link":"/company/00006400",`+
+					`"name":{"key":"ACMELTD:00006400","upper":"ACME LTD"},"status":"live"}`)
+			})
+		})
+
+		Convey("When a company has no name", func() {
+
+			mw.EXPECT().LogMissingCompanyName("00000001")
+
+			esData := tr.TransformMongoCompanyToEsCompany(decodeCompany(bson.M{"_id": "00000001", "data": bson.M{}}), &ak, nil)
+
+			Convey("Then it should be skipped", func() {
+
+				So(esData, ShouldBeNil)
+			})
+		})
+
+		Convey("When the company names are asked for", func() {
+
+			companies := []*datastructures.MongoCompany{company, nil, {ID: "undecoded"}}
+			names := tr.GetCompanyNames(&companies, 3)
+
+			Convey("Then the names should be read from the name path", func() {
+
+				So(names, ShouldResemble, []datastructures.CompanyName{{Name: " Acme Ltd "}, {}, {}})
+			})
+		})
+	})
+}
+
+func TestUnitShippedMapping(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	mw := write.NewMockWriter(ctrl)
+	f := format.NewFormatter()
+
+	Convey("Given the field mapping shipped with the loader", t, func() {
+
+		m, err := LoadMapping(companyMapping)
+		So(err, ShouldBeNil)
+
+		company := decodeCompany(bson.M{"_id": "00006400", "data": bson.M{
+			"company_name":     "ACME & SONS LTD",
+			"company_number":   "00006400",
+			"company_status":   "active",
+			"type":             "ltd",
+			"date_of_creation": time.Date(1890, time.March, 4, 0, 0, 0, 0, time.UTC),
+			"registered_office_address": bson.M{
+				"premises":       "1",
+				"address_line_1": "High Street",
+				"locality":       "Cardiff",
+				"postal_code":    "CF14 3UZ",
+			},
+			"sic_codes":    bson.A{"62012", "62020"},
+			"jurisdiction": "england-wales",
+			"previous_company_names": bson.A{
+				bson.M{
+					"name":           "ACME LTD",
+					"effective_from": time.Date(1890, time.March, 4, 0, 0, 0, 0, time.UTC),
+					"ceased_on":      time.Date(1920, time.July, 1, 0, 0, 0, 0, time.UTC),
+				},
+				bson.M{"name": "WIDGETS LTD"},
+			},
+		}})
+		ak := datastructures.AlphaKey{SameAsAlphaKey: "ACMEANDSONS", OrderedAlphaKey: "ACMEANDSONSLTD"}
+		previous := []datastructures.AlphaKey{
+			{SameAsAlphaKey: "ACME", OrderedAlphaKey: "ACMELTD"},
+			{SameAsAlphaKey: "WIDGETS", OrderedAlphaKey: "WIDGETSLTD"},
+		}
+
+		mapper := NewMappedTransformer(mw, f, m)
+		builtIn := NewTransformer(mw, f)
+
+		Convey("When a company is transformed by it and by the built in transformer", func() {
+
+			mappedDoc, err := json.Marshal(mapper.TransformMongoCompanyToEsCompany(company, &ak, previous))
+			So(err, ShouldBeNil)
+			builtInDoc, err := json.Marshal(builtIn.TransformMongoCompanyToEsCompany(company, &ak, previous))
+			So(err, ShouldBeNil)
+
+			Convey("Then the documents should be the same", func() {
+
+				So(string(mappedDoc), ShouldEqualJSON, string(builtInDoc))
+				So(string(mappedDoc), ShouldContainSubstring, `"registered_office_address_snippet":"1 High Street, Cardiff, CF14 3UZ"`)
+				So(string(mappedDoc), ShouldContainSubstring, `"previous_company_names":[{`)
+			})
+		})
+
+		Convey("When the names of companies are asked for by it and by the built in transformer", func() {
+
+			companies := []*datastructures.MongoCompany{company, company}
+
+			Convey("Then the same names should be returned, as many previous names following as are counted", func() {
+
+				So(mapper.GetCompanyNames(&companies, 2), ShouldResemble, builtIn.GetCompanyNames(&companies, 2))
+				So(mapper.(PreviousNameCounter).PreviousNameCount(company), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestUnitOfficerMapping(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	mw := write.NewMockWriter(ctrl)
+
+	Convey("Given the officer field mapping", t, func() {
+
+		m, err := LoadMapping("../config/officer_mapping.json")
+		So(err, ShouldBeNil)
+		tr := NewMappedTransformer(mw, format.NewFormatter(), m)
+
+		officer := decodeCompany(bson.M{
+			"_id":            "appointment1",
+			"officer_id":     "officer1",
+			"company_number": "00006400",
+			"company_name":   "ACME LIMITED",
+			"data": bson.M{
+				"forename":     "Joe",
+				"surname":      "BLOGGS ",
+				"officer_role": "director",
+				"appointed_on": time.Date(2001, time.May, 6, 0, 0, 0, 0, time.UTC),
+				"links":        bson.M{"self": "/company/00006400/appointments/appointment1"},
+			},
+		})
+
+		Convey("When an appointment is transformed", func() {
+
+			companies := []*datastructures.MongoCompany{officer}
+			names := tr.GetCompanyNames(&companies, 1)
+			doc, err := json.Marshal(tr.TransformMongoCompanyToEsCompany(officer, &datastructures.AlphaKey{
+				SameAsAlphaKey: "BLOGGS", OrderedAlphaKey: "BLOGGS",
+			}, nil))
+
+			Convey("Then the officer document should be built from it", func() {
+
+				So(names, ShouldResemble, []datastructures.CompanyName{{Name: "BLOGGS "}})
+				So(err, ShouldBeNil)
+				So(string(doc), ShouldEqualJSON, `{
+					"ID": "appointment1",
+					"kind": "searchresults#officer",
+					"links": {"self": "/company/00006400/appointments/appointment1"},
+					"ordered_alpha_key_with_id": "BLOGGS:appointment1",
+					"items": {
+						"officer_id": "officer1",
+						"company_number": "00006400",
+						"company_name": "ACME LIMITED",
+						"forename": "Joe",
+						"surname": "BLOGGS",
+						"officer_role": "director",
+						"appointed_on": "2001-05-06",
+						"record_type": "officers",
+						"alpha_key": "BLOGGS",
+						"ordered_alpha_key": "BLOGGS"
+					}
+				}`)
+			})
+		})
+	})
+}
@@ -49,15 +49,15 @@ func (mr *MockTransformerMockRecorder) GetCompanyNames(companies, length interfa
 }
 
 // TransformMongoCompanyToEsCompany mocks base method.
-func (m *MockTransformer) TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey) *datastructures.EsCompany {
+func (m *MockTransformer) TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey, previousAlphaKeys []datastructures.AlphaKey) *datastructures.EsCompany {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TransformMongoCompanyToEsCompany", mongoCompany, alphaKey)
+	ret := m.ctrl.Call(m, "TransformMongoCompanyToEsCompany", mongoCompany, alphaKey, previousAlphaKeys)
 	ret0, _ := ret[0].(*datastructures.EsCompany)
 	return ret0
 }
 
 // TransformMongoCompanyToEsCompany indicates an expected call of TransformMongoCompanyToEsCompany.
-func (mr *MockTransformerMockRecorder) TransformMongoCompanyToEsCompany(mongoCompany, alphaKey interface{}) *gomock.Call {
+func (mr *MockTransformerMockRecorder) TransformMongoCompanyToEsCompany(mongoCompany, alphaKey, previousAlphaKeys interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransformMongoCompanyToEsCompany", reflect.TypeOf((*MockTransformer)(nil).TransformMongoCompanyToEsCompany), mongoCompany, alphaKey)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransformMongoCompanyToEsCompany", reflect.TypeOf((*MockTransformer)(nil).TransformMongoCompanyToEsCompany), mongoCompany, alphaKey, previousAlphaKeys)
 }
@@ -3,20 +3,33 @@ package transform
 import (
 	"fmt"
 	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
 	"github.com/companieshouse/elasticsearch-data-loader/format"
 	"github.com/companieshouse/elasticsearch-data-loader/write"
 )
 
-const recordKind = "searchresults#company"
+const (
+	recordKind   = "searchresults#company"
+	activeStatus = "active"
+	dateLayout   = "2006-01-02"
+)
 
 // Transformer provides an interface by which to transform data from one form to another
 type Transformer interface {
-	TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey) *datastructures.EsCompany
+	TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey, previousAlphaKeys []datastructures.AlphaKey) *datastructures.EsCompany
 	GetCompanyNames(companies *[]*datastructures.MongoCompany, length int) []datastructures.CompanyName
 }
 
+// PreviousNameCounter is implemented by a Transformer which fetches the alpha keys of previous names other than
+// those held in MongoData, to say how many of them follow the names of the companies
+type PreviousNameCounter interface {
+	PreviousNameCount(mongoCompany *datastructures.MongoCompany) int
+}
+
 // Transform provides a concrete implementation of the Transformer interface
 type Transform struct {
 	w write.Writer
@@ -32,8 +45,9 @@ func NewTransformer(writer write.Writer, formatter format.Formatter) Transformer
 	}
 }
 
-// TransformMongoCompanyToEsCompany transforms a MongoCompany and its relevant AlphaKey into its EsCompany counterpart
-func (t *Transform) TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey) *datastructures.EsCompany {
+// TransformMongoCompanyToEsCompany transforms a MongoCompany and its relevant AlphaKey into its EsCompany counterpart,
+// taking the AlphaKeys of its previous company names in the order they are held
+func (t *Transform) TransformMongoCompanyToEsCompany(mongoCompany *datastructures.MongoCompany, alphaKey *datastructures.AlphaKey, previousAlphaKeys []datastructures.AlphaKey) *datastructures.EsCompany {
 	if mongoCompany.Data == nil {
 		t.w.LogMissingCompanyData(fmt.Sprintf("Missing company data element for company ID %s", mongoCompany.ID))
 		return nil
@@ -56,23 +70,43 @@ func (t *Transform) TransformMongoCompanyToEsCompany(mongoCompany *datastructure
 	nameStart, nameEnding := t.f.SplitCompanyNameEndings(mongoCompany.Data.CompanyName)
 
 	items := datastructures.EsItem{
-		CompanyStatus:       mongoCompany.Data.CompanyStatus,
-		CompanyNumber:       mongoCompany.Data.CompanyNumber,
-		CorporateName:       name,
-		CorporateNameStart:  nameStart,
-		CorporateNameEnding: nameEnding,
-		RecordType:          "companies",
-		AlphaKey:            alphaKey.SameAsAlphaKey,
-		OrderedAlphaKey:     alphaKey.OrderedAlphaKey,
+		CompanyStatus:                  mongoCompany.Data.CompanyStatus,
+		CompanyNumber:                  mongoCompany.Data.CompanyNumber,
+		CorporateName:                  name,
+		CorporateNameStart:             nameStart,
+		CorporateNameEnding:            nameEnding,
+		RecordType:                     "companies",
+		AlphaKey:                       alphaKey.SameAsAlphaKey,
+		OrderedAlphaKey:                alphaKey.OrderedAlphaKey,
+		DateOfCreation:                 formatDate(mongoCompany.Data.DateOfCreation),
+		DateOfCessation:                formatDate(mongoCompany.Data.DateOfCessation),
+		RegisteredOfficeAddressSnippet: addressSnippet(mongoCompany.Data.RegisteredOfficeAddress),
+		SICCodes:                       mongoCompany.Data.SICCodes,
+		Jurisdiction:                   mongoCompany.Data.Jurisdiction,
+		PreviousCompanyNames:           previousNames(mongoCompany.Data.PreviousCompanyNames, previousAlphaKeys),
 	}
 
 	dest.Items = items
 	dest.OrderedAlphaKeyWithID = alphaKey.OrderedAlphaKey + ":" + mongoCompany.ID
+	dest.AlphaKeyWithID = alphaKey.SameAsAlphaKey + ":" + mongoCompany.ID
+
+	dest.CorporateStripped = t.f.StripCompanyName(nameStart)
+	dest.CorporateStrippedLen = utf8.RuneCountInString(dest.CorporateStripped)
+	dest.CorporateWithType = nameStart
+	if nameEnding != "" {
+		dest.CorporateWithType = nameStart + " " + t.f.NormaliseCompanyType(nameEnding)
+	}
+
+	if mongoCompany.Data.CompanyStatus == activeStatus {
+		dest.ActiveCount = 1
+	}
 
 	return &dest
 }
 
-// GetCompanyNames returns a set of 'CompanyName's for a given set of 'MongoCompany's
+// GetCompanyNames returns a set of 'CompanyName's for a given set of 'MongoCompany's, holding the name of each
+// company in turn followed by the previous names of each company in turn, so that the alpha keys of every name
+// can be fetched at once
 func (t *Transform) GetCompanyNames(companies *[]*datastructures.MongoCompany, length int) []datastructures.CompanyName {
 
 	var companyNames []datastructures.CompanyName
@@ -89,6 +123,14 @@ func (t *Transform) GetCompanyNames(companies *[]*datastructures.MongoCompany, l
 		}
 	}
 
+	for i := 0; i < length; i++ {
+		if mongoCompany := (*companies)[i]; mongoCompany != nil && mongoCompany.Data != nil {
+			for _, previous := range mongoCompany.Data.PreviousCompanyNames {
+				companyNames = append(companyNames, datastructures.CompanyName{Name: previous.Name})
+			}
+		}
+	}
+
 	return companyNames
 }
 
@@ -97,3 +139,59 @@ func (t *Transform) GetCompanyNames(companies *[]*datastructures.MongoCompany, l
 func appendCompanyNamesSpacer(companyNames []datastructures.CompanyName) []datastructures.CompanyName {
 	return append(companyNames, datastructures.CompanyName{})
 }
+
+// previousNames returns the previous names of a company with their alpha keys, leaving out any without a name
+func previousNames(names []datastructures.MongoPreviousName, alphaKeys []datastructures.AlphaKey) []datastructures.EsPreviousName {
+	var previous []datastructures.EsPreviousName
+	for i, name := range names {
+		if name.Name == "" {
+			continue
+		}
+
+		var alphaKey datastructures.AlphaKey
+		if i < len(alphaKeys) {
+			alphaKey = alphaKeys[i]
+		}
+		previous = append(previous, datastructures.EsPreviousName{
+			Name:            name.Name,
+			AlphaKey:        alphaKey.SameAsAlphaKey,
+			OrderedAlphaKey: alphaKey.OrderedAlphaKey,
+			EffectiveFrom:   formatDate(name.EffectiveFrom),
+			CeasedOn:        formatDate(name.CeasedOn),
+		})
+	}
+	return previous
+}
+
+// formatDate returns date as a day in the form Elasticsearch expects, or an empty string if there is no date
+func formatDate(date *time.Time) string {
+	if date == nil || date.IsZero() {
+		return ""
+	}
+	return date.UTC().Format(dateLayout)
+}
+
+// addressSnippet returns an address on a single line, as shown in search results, with the premises before
+// the first line and the parts which are not set left out
+func addressSnippet(address *datastructures.MongoAddress) string {
+	if address == nil {
+		return ""
+	}
+
+	var parts []string
+	for _, part := range []string{
+		address.CareOf,
+		address.POBox,
+		strings.TrimSpace(address.Premises + " " + address.AddressLine1),
+		address.AddressLine2,
+		address.Locality,
+		address.Region,
+		address.Country,
+		address.PostalCode,
+	} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -1,7 +1,10 @@
 package transform
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
 	"github.com/companieshouse/elasticsearch-data-loader/format"
@@ -18,8 +21,10 @@ const (
 
 	id = "id"
 
-	nameStart = "nameStart"
-	nameEnd   = "nameEnd"
+	nameStart      = "nameStart"
+	nameEnd        = "nameEnd"
+	strippedName   = "NAMESTART"
+	normalisedType = "NORMALISEDTYPE"
 
 	sameAsAlphaKey  = "sameAsAlphaKey"
 	orderedAlphaKey = "orderedAlphaKey"
@@ -32,6 +37,8 @@ const (
 	callGetCompanyNames                  = "When I call GetCompanyNames"
 )
 
+const searchScheme = "../config/search_scheme.json"
+
 func TestUnitTransformMongoCompanyToEsCompany(t *testing.T) {
 
 	ctrl := gomock.NewController(t)
@@ -63,9 +70,11 @@ func TestUnitTransformMongoCompanyToEsCompany(t *testing.T) {
 		Convey(callTransformMongoCompanyToEsCompany, func() {
 
 			mf.EXPECT().SplitCompanyNameEndings(md.CompanyName).Return(nameStart, nameEnd)
+			mf.EXPECT().StripCompanyName(nameStart).Return(strippedName)
+			mf.EXPECT().NormaliseCompanyType(nameEnd).Return(normalisedType)
 			mw.EXPECT().LogMissingCompanyData("Missing company data element for company ID id")
 
-			esData := mwf.TransformMongoCompanyToEsCompany(&mc, &ak)
+			esData := mwf.TransformMongoCompanyToEsCompany(&mc, &ak, nil)
 
 			Convey("Then I expect a fully populated EsItem", func() {
 
@@ -77,6 +86,11 @@ func TestUnitTransformMongoCompanyToEsCompany(t *testing.T) {
 				So(esData.Items.CorporateName, ShouldEqual, companyName)
 				So(esData.Items.CorporateNameStart, ShouldEqual, nameStart)
 				So(esData.Items.CorporateNameEnding, ShouldEqual, nameEnd)
+				So(esData.AlphaKeyWithID, ShouldEqual, sameAsAlphaKey+":"+id)
+				So(esData.CorporateStripped, ShouldEqual, strippedName)
+				So(esData.CorporateStrippedLen, ShouldEqual, len(strippedName))
+				So(esData.CorporateWithType, ShouldEqual, nameStart+" "+normalisedType)
+				So(esData.ActiveCount, ShouldEqual, 0)
 			})
 		})
 	})
@@ -91,7 +105,7 @@ func TestUnitTransformMongoCompanyToEsCompany(t *testing.T) {
 
 			mw.EXPECT().LogMissingCompanyData("Missing company data element for company ID ")
 
-			esData := mwf.TransformMongoCompanyToEsCompany(&mc, &ak)
+			esData := mwf.TransformMongoCompanyToEsCompany(&mc, &ak, nil)
 
 			Convey("I expect it to return nil", func() {
 				So(esData, ShouldBeNil)
@@ -122,7 +136,7 @@ func TestUnitTransformMongoCompanyToEsCompany(t *testing.T) {
 
 			Convey(callTransformMongoCompanyToEsCompany, func() {
 
-				esData := mwf.TransformMongoCompanyToEsCompany(&mc, &ak)
+				esData := mwf.TransformMongoCompanyToEsCompany(&mc, &ak, nil)
 
 				Convey("And I expect esData to be nil", func() {
 
@@ -133,6 +147,144 @@ func TestUnitTransformMongoCompanyToEsCompany(t *testing.T) {
 	})
 }
 
+func TestUnitDerivedFields(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	tr := NewTransformer(write.NewMockWriter(ctrl), format.NewFormatter())
+
+	Convey("Given an active company with an abbreviated company type", t, func() {
+
+		mc := datastructures.MongoCompany{
+			ID: "00006400",
+			Data: &datastructures.MongoData{
+				CompanyName:   "A & B (HOLDINGS) LTD.",
+				CompanyNumber: "00006400",
+				CompanyStatus: "active",
+			},
+		}
+		ak := datastructures.AlphaKey{SameAsAlphaKey: "AANDBHOLDINGS", OrderedAlphaKey: "AANDBHOLDINGSLTD"}
+
+		Convey(callTransformMongoCompanyToEsCompany, func() {
+
+			esData := tr.TransformMongoCompanyToEsCompany(&mc, &ak, nil)
+
+			Convey("Then the derived fields should be populated", func() {
+
+				So(esData.CorporateStripped, ShouldEqual, "ABHOLDINGS")
+				So(esData.CorporateStrippedLen, ShouldEqual, 10)
+				So(esData.CorporateWithType, ShouldEqual, "A & B (HOLDINGS) LIMITED")
+				So(esData.AlphaKeyWithID, ShouldEqual, "AANDBHOLDINGS:00006400")
+				So(esData.ActiveCount, ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Should leave the name as it is when it has no company type", t, func() {
+
+		mc := datastructures.MongoCompany{ID: "id", Data: &datastructures.MongoData{CompanyName: "Acme Widgets"}}
+
+		esData := tr.TransformMongoCompanyToEsCompany(&mc, &datastructures.AlphaKey{}, nil)
+
+		So(esData.CorporateWithType, ShouldEqual, "Acme Widgets")
+		So(esData.CorporateStripped, ShouldEqual, "ACMEWIDGETS")
+	})
+}
+
+func TestUnitCompanyDetails(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	tr := NewTransformer(write.NewMockWriter(ctrl), format.NewFormatter())
+
+	Convey("Given a dissolved company with its registered office and SIC codes", t, func() {
+
+		created := time.Date(1890, time.March, 4, 0, 0, 0, 0, time.UTC)
+		ceased := time.Date(2001, time.December, 31, 0, 0, 0, 0, time.UTC)
+		mc := datastructures.MongoCompany{
+			ID: "00006400",
+			Data: &datastructures.MongoData{
+				CompanyName:     "ACME LIMITED",
+				CompanyStatus:   "dissolved",
+				DateOfCreation:  &created,
+				DateOfCessation: &ceased,
+				RegisteredOfficeAddress: &datastructures.MongoAddress{
+					Premises:     "1",
+					AddressLine1: "High Street",
+					Locality:     "Cardiff",
+					PostalCode:   "CF14 3UZ",
+				},
+				SICCodes:     []string{"62012", "62020"},
+				Jurisdiction: "england-wales",
+			},
+		}
+
+		Convey(callTransformMongoCompanyToEsCompany, func() {
+
+			items := tr.TransformMongoCompanyToEsCompany(&mc, &datastructures.AlphaKey{}, nil).Items
+
+			Convey("Then its details should be included", func() {
+
+				So(items.DateOfCreation, ShouldEqual, "1890-03-04")
+				So(items.DateOfCessation, ShouldEqual, "2001-12-31")
+				So(items.RegisteredOfficeAddressSnippet, ShouldEqual, "1 High Street, Cardiff, CF14 3UZ")
+				So(items.SICCodes, ShouldResemble, []string{"62012", "62020"})
+				So(items.Jurisdiction, ShouldEqual, "england-wales")
+			})
+		})
+	})
+
+	Convey("Should leave out details the company does not have", t, func() {
+
+		mc := datastructures.MongoCompany{ID: "id", Data: &datastructures.MongoData{CompanyName: "ACME LIMITED"}}
+
+		doc, err := json.Marshal(tr.TransformMongoCompanyToEsCompany(&mc, &datastructures.AlphaKey{}, nil).Items)
+
+		So(err, ShouldBeNil)
+		So(string(doc), ShouldNotContainSubstring, "date_of_cessation")
+		So(string(doc), ShouldNotContainSubstring, "registered_office_address_snippet")
+		So(string(doc), ShouldNotContainSubstring, "sic_codes")
+	})
+}
+
+func TestUnitPreviousCompanyNames(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	tr := NewTransformer(write.NewMockWriter(ctrl), format.NewFormatter())
+
+	Convey("Given a company which has been renamed twice", t, func() {
+
+		renamed := time.Date(2010, time.June, 1, 0, 0, 0, 0, time.UTC)
+		mc := datastructures.MongoCompany{
+			ID: "00006400",
+			Data: &datastructures.MongoData{
+				CompanyName: "ACME LIMITED",
+				PreviousCompanyNames: []datastructures.MongoPreviousName{
+					{Name: "WIDGETS LIMITED", EffectiveFrom: &renamed},
+					{Name: ""},
+					{Name: "GADGETS PLC", CeasedOn: &renamed},
+				},
+			},
+		}
+		previousKeys := []datastructures.AlphaKey{
+			{SameAsAlphaKey: "WIDGETS", OrderedAlphaKey: "WIDGETSLIMITED"},
+			{},
+			{SameAsAlphaKey: "GADGETS", OrderedAlphaKey: "GADGETSPLC"},
+		}
+
+		Convey(callTransformMongoCompanyToEsCompany, func() {
+
+			items := tr.TransformMongoCompanyToEsCompany(&mc, &datastructures.AlphaKey{}, previousKeys).Items
+
+			Convey("Then each previous name should be included with its own alpha keys", func() {
+
+				So(items.PreviousCompanyNames, ShouldResemble, []datastructures.EsPreviousName{
+					{Name: "WIDGETS LIMITED", AlphaKey: "WIDGETS", OrderedAlphaKey: "WIDGETSLIMITED", EffectiveFrom: "2010-06-01"},
+					{Name: "GADGETS PLC", AlphaKey: "GADGETS", OrderedAlphaKey: "GADGETSPLC", CeasedOn: "2010-06-01"},
+				})
+			})
+		})
+	})
+}
+
 func TestUnitGetCompanyNames(t *testing.T) {
 
 	ctrl := gomock.NewController(t)
@@ -304,3 +456,138 @@ func TestUnitGetCompanyNamesNilMongoCompany(t *testing.T) {
 		})
 	})
 }
+
+func TestUnitGetCompanyNamesWithPreviousNames(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+
+	mwf := NewTransformer(write.NewMockWriter(ctrl), format.NewMockFormatter(ctrl))
+
+	Convey("Given I have mongo companies with previous names", t, func() {
+
+		mc1 := datastructures.MongoCompany{
+			Data: &datastructures.MongoData{
+				CompanyName:          companyOne,
+				PreviousCompanyNames: []datastructures.MongoPreviousName{{Name: "formerOne"}, {Name: "earlierOne"}},
+			},
+		}
+
+		mc2 := datastructures.MongoCompany{}
+
+		mc3 := datastructures.MongoCompany{
+			Data: &datastructures.MongoData{
+				CompanyName:          companyThree,
+				PreviousCompanyNames: []datastructures.MongoPreviousName{{Name: "formerThree"}},
+			},
+		}
+
+		companies := []*datastructures.MongoCompany{&mc1, &mc2, &mc3}
+
+		Convey(callGetCompanyNames, func() {
+
+			companyNames := mwf.GetCompanyNames(&companies, 3)
+
+			Convey("Then the names should be followed by the previous names, in order", func() {
+
+				So(companyNames, ShouldResemble, []datastructures.CompanyName{
+					{Name: companyOne}, {}, {Name: companyThree},
+					{Name: "formerOne"}, {Name: "earlierOne"}, {Name: "formerThree"},
+				})
+			})
+		})
+	})
+}
+
+func TestUnitMappingFieldsEmitted(t *testing.T) {
+
+	Convey("Given the fields mapped in the search scheme", t, func() {
+
+		b, err := ioutil.ReadFile(searchScheme)
+		So(err, ShouldBeNil)
+
+		var scheme struct {
+			Mappings schemeProperties `json:"mappings"`
+		}
+		So(json.Unmarshal(b, &scheme), ShouldBeNil)
+		So(scheme.Mappings.Properties, ShouldNotBeEmpty)
+
+		Convey("When a company with every detail set is transformed", func() {
+
+			ctrl := gomock.NewController(t)
+			tr := NewTransformer(write.NewMockWriter(ctrl), format.NewFormatter())
+
+			created := time.Date(1990, 4, 1, 0, 0, 0, 0, time.UTC)
+			ceased := time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC)
+			mc := datastructures.MongoCompany{
+				ID: "00006400",
+				Data: &datastructures.MongoData{
+					CompanyName:     "ACME LTD",
+					CompanyNumber:   "00006400",
+					CompanyStatus:   "active",
+					CompanyType:     "ltd",
+					DateOfCreation:  &created,
+					DateOfCessation: &ceased,
+					RegisteredOfficeAddress: &datastructures.MongoAddress{
+						AddressLine1: "1 High Street",
+						Locality:     "Cardiff",
+						PostalCode:   "CF14 3UZ",
+					},
+					SICCodes:     []string{"62012"},
+					Jurisdiction: "england-wales",
+					PreviousCompanyNames: []datastructures.MongoPreviousName{
+						{Name: "WIDGET LTD", EffectiveFrom: &created, CeasedOn: &ceased},
+					},
+				},
+			}
+			ak := datastructures.AlphaKey{SameAsAlphaKey: "ACME", OrderedAlphaKey: "ACMELTD"}
+			previous := []datastructures.AlphaKey{{SameAsAlphaKey: "WIDGET", OrderedAlphaKey: "WIDGETLTD"}}
+
+			doc, err := json.Marshal(tr.TransformMongoCompanyToEsCompany(&mc, &ak, previous))
+			So(err, ShouldBeNil)
+
+			var emitted map[string]interface{}
+			So(json.Unmarshal(doc, &emitted), ShouldBeNil)
+
+			Convey("Then every mapped field should be emitted with a value", func() {
+
+				So(scheme.Mappings.unset(emitted, ""), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+// schemeProperties holds the fields mapped by an index scheme, and those of any object or nested field
+type schemeProperties struct {
+	Properties map[string]schemeProperties `json:"properties"`
+}
+
+// unset returns the paths of the fields mapped by p which are missing from doc, or hold a zero value
+func (p schemeProperties) unset(doc map[string]interface{}, prefix string) []string {
+	var paths []string
+	for field, properties := range p.Properties {
+		path := prefix + field
+		value := doc[field]
+		// Nested fields hold an array of objects, each of which should have every field mapped.
+		if array, ok := value.([]interface{}); ok && len(properties.Properties) > 0 && len(array) > 0 {
+			value = array[0]
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			paths = append(paths, properties.unset(v, path+".")...)
+		case []interface{}:
+			if len(v) == 0 {
+				paths = append(paths, path)
+			}
+		case nil, bool:
+			if v != true {
+				paths = append(paths, path)
+			}
+		default:
+			if v == "" || v == 0.0 {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,92 @@
+package write
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+)
+
+// maxDeadLetterSize is the longest line ReadDeadLetters will accept, allowing for large company documents
+const maxDeadLetterSize = 10 * 1024 * 1024
+
+// DeadLetterWriter provides an interface by which to record failed documents in a replayable form
+type DeadLetterWriter interface {
+	Write(deadLetter datastructures.DeadLetter)
+	Close()
+}
+
+// DeadLetterWrite provides a concrete implementation of the DeadLetterWriter interface, appending
+// each DeadLetter to a file as a line of JSON
+type DeadLetterWrite struct {
+	mu   sync.Mutex
+	name string
+	file *os.File
+}
+
+// NewDeadLetterWriter returns a concrete implementation of the DeadLetterWriter interface, appending to the named file
+func NewDeadLetterWriter(name string) DeadLetterWriter {
+
+	file, err := openFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		fatalf(errorOpeningFile, name)
+	}
+
+	return &DeadLetterWrite{
+		name: name,
+		file: file,
+	}
+}
+
+// Write appends a DeadLetter to the dead-letter file
+func (d *DeadLetterWrite) Write(deadLetter datastructures.DeadLetter) {
+
+	b, err := json.Marshal(deadLetter)
+	if err != nil {
+		log.Printf("error marshalling dead letter for [%s]: %s", deadLetter.ID, err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	writeToFile(d.file, d.name, string(b))
+}
+
+// Close closes a DeadLetterWriter
+func (d *DeadLetterWrite) Close() {
+
+	if err := closeFile(d.file); err != nil {
+		fatalf(errorClosingFile, err)
+	}
+}
+
+// ReadDeadLetters reads every DeadLetter from a file written by a DeadLetterWriter
+func ReadDeadLetters(name string) ([]datastructures.DeadLetter, error) {
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var deadLetters []datastructures.DeadLetter
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDeadLetterSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var deadLetter datastructures.DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &deadLetter); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, scanner.Err()
+}
@@ -0,0 +1,62 @@
+package write
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/elasticsearch-data-loader/datastructures"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitDeadLetterWriter(t *testing.T) {
+
+	Convey("Given a dead letter has been written", t, func() {
+
+		dir, _ := ioutil.TempDir("", "deadletter")
+		defer os.RemoveAll(dir)
+
+		name := filepath.Join(dir, "deadLetter.ndjson")
+		deadLetter := datastructures.DeadLetter{
+			ID:        "00006400",
+			Action:    json.RawMessage(`{"create":{"_id":"00006400"}}`),
+			Document:  json.RawMessage(`{"ID":"00006400","kind":"searchresults#company"}`),
+			Reason:    "mapper_parsing_exception: failed to parse",
+			Status:    400,
+			Timestamp: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		}
+
+		writer := NewDeadLetterWriter(name)
+		writer.Write(deadLetter)
+		writer.Write(deadLetter)
+		writer.Close()
+
+		Convey("When ReadDeadLetters is called", func() {
+
+			deadLetters, err := ReadDeadLetters(name)
+
+			Convey("Then every dead letter should be read back intact", func() {
+
+				So(err, ShouldBeNil)
+				So(len(deadLetters), ShouldEqual, 2)
+				So(deadLetters[0], ShouldResemble, deadLetter)
+			})
+		})
+	})
+
+	Convey("Given the dead-letter file cannot be opened", t, func() {
+
+		restoreOpenFile := stubOpenFile("deadLetter.ndjson")
+		defer restoreOpenFile()
+
+		restoreLogFatalf := stubLogFatalf()
+		defer restoreLogFatalf()
+
+		So(func() { NewDeadLetterWriter("deadLetter.ndjson") },
+			ShouldPanicWith,
+			"error opening [deadLetter.ndjson] file")
+	})
+}